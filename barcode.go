@@ -0,0 +1,167 @@
+package watermark
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// ErrInvalidBarcode 条形码的内容无效
+var ErrInvalidBarcode = errors.New("无效的条形码内容")
+
+// Code128 各个字符的条空宽度，依次为条、空、条、空……，最后一项为终止符。
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128Stop   = 106
+)
+
+// EAN-13 左侧数据的 L 编码，G 编码和右侧的 R 编码均由其推导而来。
+var eanL = [10]string{
+	"0001101", "0011001", "0010011", "0111101", "0100011",
+	"0110001", "0101111", "0111011", "0110111", "0001011",
+}
+
+// EAN-13 第一位数字决定左侧六位数字所使用的编码，L 或是 G。
+var eanParity = [10]string{
+	"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG",
+	"LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL",
+}
+
+// Code128 生成内容为 s 的 Code128 条形码图片
+//
+// s 只能包含 ASCII 中的可打印字符，使用 Code128 的 B 字符集编码；
+// module 为最窄线条的像素宽度，height 为条形码的高度；
+// fg 和 bg 分别为线条和背景的颜色，两侧会各自保留 10 个 module 宽度的空白区。
+func Code128(s string, module, height int, fg, bg color.Color) (image.Image, error) {
+	if s == "" {
+		return nil, ErrInvalidBarcode
+	}
+
+	values := make([]int, 0, len(s)+3)
+	values = append(values, code128StartB)
+	sum := code128StartB
+	for i := 0; i < len(s); i++ {
+		if s[i] < 32 || s[i] > 126 {
+			return nil, ErrInvalidBarcode
+		}
+		v := int(s[i]) - 32
+		values = append(values, v)
+		sum += (i + 1) * v
+	}
+	values = append(values, sum%103, code128Stop)
+
+	var modules []bool
+	for _, v := range values {
+		for i, r := range code128Patterns[v] {
+			for n := 0; n < int(r-'0'); n++ {
+				modules = append(modules, i%2 == 0)
+			}
+		}
+	}
+
+	return barcode(modules, 10, module, height, fg, bg), nil
+}
+
+// EAN13 生成内容为 s 的 EAN-13 条形码图片
+//
+// s 为 12 位或 13 位数字，为 12 位时会自动计算校验位，为 13 位时会检测校验位是否正确；
+// 其它参数与 Code128 相同，两侧的空白区分别为 11 和 7 个 module 宽度。
+func EAN13(s string, module, height int, fg, bg color.Color) (image.Image, error) {
+	if len(s) != 12 && len(s) != 13 {
+		return nil, ErrInvalidBarcode
+	}
+
+	digits := make([]int, 13)
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return nil, ErrInvalidBarcode
+		}
+		digits[i] = int(s[i] - '0')
+		if i < 12 {
+			sum += digits[i] * (1 + 2*(i%2))
+		}
+	}
+	check := (10 - sum%10) % 10
+	if len(s) == 13 && digits[12] != check {
+		return nil, ErrInvalidBarcode
+	}
+	digits[12] = check
+
+	bits := "101"
+	for i, p := range eanParity[digits[0]] {
+		if p == 'L' {
+			bits += eanL[digits[i+1]]
+		} else {
+			bits += eanG(digits[i+1])
+		}
+	}
+	bits += "01010"
+	for _, d := range digits[7:] {
+		bits += eanR(d)
+	}
+	bits += "101"
+
+	modules := make([]bool, len(bits))
+	for i := range bits {
+		modules[i] = bits[i] == '1'
+	}
+
+	// 左右空白区不对称，在左侧补齐相差的 4 个 module。
+	modules = append(make([]bool, 4, 4+len(modules)), modules...)
+	return barcode(modules, 7, module, height, fg, bg), nil
+}
+
+// 返回数字 d 的 R 编码，即 L 编码按位取反。
+func eanR(d int) string {
+	b := []byte(eanL[d])
+	for i := range b {
+		b[i] ^= 1
+	}
+	return string(b)
+}
+
+// 返回数字 d 的 G 编码，即 R 编码的逆序。
+func eanG(d int) string {
+	r := eanR(d)
+	b := make([]byte, len(r))
+	for i := range r {
+		b[len(r)-1-i] = r[i]
+	}
+	return string(b)
+}
+
+// 将 modules 绘制为条形码图片，quiet 为两侧的空白区宽度，以 module 为单位。
+func barcode(modules []bool, quiet, module, height int, fg, bg color.Color) image.Image {
+	if module <= 0 || height <= 0 {
+		panic("参数 module 和 height 必须大于 0")
+	}
+
+	width := (len(modules) + 2*quiet) * module
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.ZP, draw.Src)
+
+	fill := image.NewUniform(fg)
+	for i, bar := range modules {
+		if bar {
+			x := (quiet + i) * module
+			draw.Draw(img, image.Rect(x, 0, x+module, height), fill, image.ZP, draw.Src)
+		}
+	}
+	return img
+}
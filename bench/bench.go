@@ -0,0 +1,163 @@
+// Package bench 提供标准化的性能测试负载，用于比较 watermark 各类选项组合的性能。
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/hard88/watermark/v2"
+)
+
+// DefaultSizes 默认的目标图片尺寸
+var DefaultSizes = []image.Point{
+	{640, 480},
+	{1920, 1080},
+	{4000, 3000},
+}
+
+// DefaultFormats 默认的目标图片格式
+var DefaultFormats = []string{".jpg", ".png"}
+
+// Workload 一组性能测试负载，会测试 Sizes、Formats 和 Options 的所有组合。
+type Workload struct {
+	Sizes   []image.Point                 // 目标图片的尺寸，为空时使用 DefaultSizes
+	Formats []string                      // 目标图片的格式，为空时使用 DefaultFormats
+	Options map[string]*watermark.Options // 以名称区分的选项，为空时只测试默认选项
+	Mark    image.Image                   // 水印图片，为空时使用一张 200x100 的半透明图片
+}
+
+// Result 单项性能测试的结果
+type Result struct {
+	Size        image.Point
+	Format      string
+	Options     string  // Workload.Options 中的名称
+	NsPerOp     int64   // 每张图片的耗时
+	MPixPerSec  float64 // 每秒处理的百万像素数
+	AllocsPerOp int64   // 每张图片的内存分配次数
+	BytesPerOp  int64   // 每张图片分配的字节数
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%dx%d %s %s\t%d ns/op\t%.2f MPix/s\t%d allocs/op\t%d B/op",
+		r.Size.X, r.Size.Y, r.Format, r.Options, r.NsPerOp, r.MPixPerSec, r.AllocsPerOp, r.BytesPerOp)
+}
+
+// Run 运行 wl 中所有组合的性能测试，并返回结果。
+//
+// 结果按尺寸、格式和选项名称的顺序排列，每项测试至少运行一秒。
+// Options 中存在无效的选项时，不会运行任何测试，直接返回 Options.Validate 的错误。
+func Run(wl Workload) ([]Result, error) {
+	sizes := wl.Sizes
+	if len(sizes) == 0 {
+		sizes = DefaultSizes
+	}
+	formats := wl.Formats
+	if len(formats) == 0 {
+		formats = DefaultFormats
+	}
+	opts := wl.Options
+	if len(opts) == 0 {
+		opts = map[string]*watermark.Options{"default": nil}
+	}
+	mark := wl.Mark
+	if mark == nil {
+		mark = defaultMark()
+	}
+
+	names := make([]string, 0, len(opts))
+	for name := range opts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// NewFromImage 遇到无效的选项会 panic，所以在开始测试之前先行检测。
+	for _, name := range names {
+		if o := opts[name]; o != nil {
+			if err := o.Validate(); err != nil {
+				return nil, fmt.Errorf("选项 %s：%w", name, err)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(sizes)*len(formats)*len(opts))
+	for _, size := range sizes {
+		for _, format := range formats {
+			src, mimetype, err := target(size, format)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, name := range names {
+				w := watermark.NewFromImage(mark, opts[name])
+				point := image.Pt(-size.X/2, -size.Y/2)
+
+				var markErr error
+				r := testing.Benchmark(func(b *testing.B) {
+					b.ReportAllocs()
+					for i := 0; i < b.N; i++ {
+						if err := w.MarkMIME(bytes.NewReader(src), io.Discard, mimetype, point); err != nil {
+							markErr = err
+							b.FailNow()
+						}
+					}
+				})
+				if markErr != nil {
+					return nil, markErr
+				}
+
+				result := Result{
+					Size:        size,
+					Format:      format,
+					Options:     name,
+					NsPerOp:     r.NsPerOp(),
+					AllocsPerOp: r.AllocsPerOp(),
+					BytesPerOp:  r.AllocedBytesPerOp(),
+				}
+				if result.NsPerOp > 0 {
+					result.MPixPerSec = float64(size.X*size.Y) / float64(result.NsPerOp) * 1e3
+				}
+				results = append(results, result)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// 生成指定尺寸和格式的目标图片，返回编码后的内容及其 MIME 类型。
+func target(size image.Point, format string) ([]byte, string, error) {
+	img := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 255})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	switch format {
+	case ".jpg", ".jpeg":
+		err := jpeg.Encode(buf, img, nil)
+		return buf.Bytes(), "image/jpeg", err
+	case ".png":
+		err := png.Encode(buf, img)
+		return buf.Bytes(), "image/png", err
+	default:
+		return nil, "", watermark.ErrUnsupportedWatermarkType
+	}
+}
+
+// 返回默认的水印图片
+func defaultMark() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = 255, 255, 255, 128
+	}
+	return img
+}
@@ -0,0 +1,18 @@
+package bench
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hard88/watermark/v2"
+)
+
+func TestRunInvalidOptions(t *testing.T) {
+	_, err := Run(Workload{Options: map[string]*watermark.Options{
+		"default": nil,
+		"webp":    {Format: ".webp"},
+	}})
+	if !errors.Is(err, watermark.ErrInvalidOptions) {
+		t.Fatalf("应返回 ErrInvalidOptions，实际为 %v", err)
+	}
+}
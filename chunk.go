@@ -0,0 +1,82 @@
+package watermark
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Chunked 以分块形式提供的已编码水印图片
+//
+// 解码、绘制和编码只在 MarkChunked 中进行一次，之后每次调用 Chunk 都返回一个新的 io.Reader，
+// 因此在写入远程存储等不可靠的目标时，可以单独重试失败的分块，而无需重新处理整张图片。
+type Chunked struct {
+	data []byte
+	size int
+	ext  string
+}
+
+// MarkChunked 将水印写入 src 中，并将编码之后的结果按 chunkSize 字节分块，由 ext 确定当前图片的类型。
+//
+// 编码结果会完整保存在内存中，水印位置由 pos 计算得出。
+func (w *Watermark) MarkChunked(src io.Reader, ext string, pos PositionFunc, chunkSize int) (*Chunked, error) {
+	if chunkSize <= 0 {
+		panic("参数 chunkSize 必须大于 0")
+	}
+
+	meta := FileMeta{Ext: strings.ToLower(ext)}
+	outExt := w.outputExt(meta.Ext)
+	buf := new(bytes.Buffer)
+	err := w.markTo(src, meta, point(pos, meta), nil, outExt, func() (io.Writer, error) {
+		return buf, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Chunked{data: buf.Bytes(), size: chunkSize, ext: outExt}, nil
+}
+
+// Ext 输出图片的扩展名
+func (c *Chunked) Ext() string { return c.ext }
+
+// Size 编码之后的总字节数
+func (c *Chunked) Size() int64 { return int64(len(c.data)) }
+
+// Len 分块的数量
+func (c *Chunked) Len() int { return (len(c.data) + c.size - 1) / c.size }
+
+// Chunk 返回第 i 个分块的内容及其在输出中的偏移量
+//
+// 每次调用都返回新的 io.Reader，可用于重试。i 超出范围时会 panic。
+func (c *Chunked) Chunk(i int) (r io.Reader, offset int64) {
+	if i < 0 || i >= c.Len() {
+		panic("参数 i 超出范围")
+	}
+
+	start := i * c.size
+	end := start + c.size
+	if end > len(c.data) {
+		end = len(c.data)
+	}
+	return bytes.NewReader(c.data[start:end]), int64(start)
+}
+
+// Each 依次将各个分块传递给 f
+//
+// f 返回错误时会使用同一分块重试，最多重试 retries 次，仍然失败则返回最后一次的错误。
+func (c *Chunked) Each(retries int, f func(i int, offset int64, r io.Reader) error) error {
+	for i := 0; i < c.Len(); i++ {
+		var err error
+		for n := 0; n <= retries; n++ {
+			r, offset := c.Chunk(i)
+			if err = f(i, offset, r); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package watermark
+
+import (
+	"errors"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidColor 无法解析的颜色值
+var ErrInvalidColor = errors.New("无效的颜色值")
+
+// CSS 中的基本颜色名称
+var namedColors = map[string]color.NRGBA{
+	"transparent": {},
+	"black":       {0x00, 0x00, 0x00, 0xff},
+	"silver":      {0xc0, 0xc0, 0xc0, 0xff},
+	"gray":        {0x80, 0x80, 0x80, 0xff},
+	"grey":        {0x80, 0x80, 0x80, 0xff},
+	"white":       {0xff, 0xff, 0xff, 0xff},
+	"maroon":      {0x80, 0x00, 0x00, 0xff},
+	"red":         {0xff, 0x00, 0x00, 0xff},
+	"purple":      {0x80, 0x00, 0x80, 0xff},
+	"fuchsia":     {0xff, 0x00, 0xff, 0xff},
+	"green":       {0x00, 0x80, 0x00, 0xff},
+	"lime":        {0x00, 0xff, 0x00, 0xff},
+	"olive":       {0x80, 0x80, 0x00, 0xff},
+	"yellow":      {0xff, 0xff, 0x00, 0xff},
+	"navy":        {0x00, 0x00, 0x80, 0xff},
+	"blue":        {0x00, 0x00, 0xff, 0xff},
+	"teal":        {0x00, 0x80, 0x80, 0xff},
+	"aqua":        {0x00, 0xff, 0xff, 0xff},
+	"orange":      {0xff, 0xa5, 0x00, 0xff},
+}
+
+// ParseColor 将字符串解析为颜色值
+//
+// s 可以是 #rgb、#rgba、#rrggbb、#rrggbbaa 形式的十六进制值，
+// 也可以是 CSS 中的基本颜色名称，比如 red、white、transparent 等，不区分大小写。
+func ParseColor(s string) (color.Color, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, found := namedColors[s]; found {
+		return c, nil
+	}
+
+	if s == "" || s[0] != '#' {
+		return nil, ErrInvalidColor
+	}
+	s = s[1:]
+
+	// 将 #rgb 和 #rgba 展开为完整形式
+	if len(s) == 3 || len(s) == 4 {
+		var b strings.Builder
+		for _, r := range s {
+			b.WriteRune(r)
+			b.WriteRune(r)
+		}
+		s = b.String()
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	if len(s) != 8 {
+		return nil, ErrInvalidColor
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, ErrInvalidColor
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
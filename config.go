@@ -0,0 +1,124 @@
+package watermark
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config Watermark 实际生效的设置，用于日志和问题反馈。
+type Config struct {
+	Path      string  // 水印文件的路径，由 NewFromImage 声明时为空
+	AssetHash string  // 水印图片内容的 sha256 值，无法读取时为空
+	Width     int     // 水印图片的宽度，无法读取时为 0
+	Height    int     // 水印图片的高度，无法读取时为 0
+	Options   Options // 填充了默认值之后的选项
+}
+
+// Config 返回实际生效的设置
+func (w *Watermark) Config() Config {
+	c := Config{
+		Path:    w.path,
+		Options: w.options.resolved(),
+	}
+	c.AssetHash, _ = w.assetHash()
+
+	w.mu.Lock()
+	img := w.image
+	w.mu.Unlock()
+
+	if img != nil {
+		c.Width, c.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	} else if f, err := os.Open(w.path); err == nil { // 未加载时只读取图片头
+		if conf, err := decodeConfig(f, strings.ToLower(filepath.Ext(w.path))); err == nil {
+			c.Width, c.Height = conf.Width, conf.Height
+		}
+		f.Close()
+	}
+
+	return c
+}
+
+// String 返回实际生效的设置的文本描述
+func (w *Watermark) String() string {
+	c := w.Config()
+	return fmt.Sprintf("watermark %s %dx%d sha256=%s %s", c.Path, c.Width, c.Height, c.AssetHash, c.Options.describe())
+}
+
+// 返回填充了默认值之后的选项，使得效果相同的选项总是返回相同的值。
+func (o Options) resolved() Options {
+	if o.MaxPixels <= 0 {
+		o.MaxPixels = DefaultMaxPixels
+	}
+	if o.Encode.JPEG != nil { // 与 image/jpeg 相同，将质量限制在 1-100 之间
+		o.Quality = clamp(o.Encode.JPEG.Quality, 1, 100)
+	} else if o.Quality <= 0 {
+		o.Quality = jpeg.DefaultQuality
+	}
+	o.Format = strings.ToLower(o.Format)
+	return o
+}
+
+// 返回所有选项的文本描述，相同的选项总是返回相同的内容。
+func (o Options) describe() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "lenient=%t spill=%d reuse=%t lazy=%t collision=%d format=%s quality=%d maxPixels=%d minContrast=%g sidecar=%t minWidth=%d minHeight=%d noBleed=%t floor=%g floorAdaptive=%t metadata=%t",
+		o.Lenient, o.SpillSize, o.Reuse, o.Lazy, o.Collision, o.Format, o.Quality, o.MaxPixels, o.MinContrast, o.Sidecar, o.MinWidth, o.MinHeight, o.NoBleed, o.Floor, o.FloorAdaptive, o.Metadata != nil)
+
+	if e := o.Encode.PNG; e != nil {
+		fmt.Fprintf(&b, " png.compression=%d", e.CompressionLevel)
+	}
+	if e := o.Encode.GIF; e != nil {
+		fmt.Fprintf(&b, " gif.colors=%d gif.quantizer=%T gif.drawer=%T", e.NumColors, e.Quantizer, e.Drawer)
+	}
+	return b.String()
+}
+
+// 返回水印图片内容的 sha256 值，计算结果会被缓存。
+func (w *Watermark) assetHash() (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.sum != "" {
+		return w.sum, nil
+	}
+
+	h := sha256.New()
+	if w.path == "" { // 由 NewFromImage 声明，以 PNG 编码后的内容代替文件内容
+		if err := png.Encode(h, w.image); err != nil {
+			return "", err
+		}
+	} else {
+		f, err := os.Open(w.path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+
+		if _, err = io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+
+	w.sum = hex.EncodeToString(h.Sum(nil))
+	return w.sum, nil
+}
+
+// 返回水印图片内容和所有选项的 sha256 值
+func (w *Watermark) configHash() (string, error) {
+	sum, err := w.assetHash()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	io.WriteString(h, sum)
+	io.WriteString(h, w.options.resolved().describe())
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
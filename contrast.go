@@ -0,0 +1,118 @@
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// 计算平均亮度时，在水平和垂直方向上的采样点数量。
+const luminanceSamples = 64
+
+// 补偿采样误差时，最多绘制背景的次数。
+const contrastPasses = 4
+
+// 当水印与其下方区域的对比度低于 Options.MinContrast 时，
+// 在水印下方绘制一块半透明的黑色或白色背景，直到对比度满足要求。
+//
+// point 的含义与 drawOver 相同，dst 中应该尚未绘制水印。
+func (w *Watermark) ensureContrast(dst draw.Image, mark image.Image, point image.Point) {
+	b := dst.Bounds()
+	r := b.Intersect(mark.Bounds().Add(b.Min.Sub(point)))
+	if r.Empty() {
+		return
+	}
+
+	lm, ok := luminance(mark, mark.Bounds().Intersect(r.Add(point.Sub(b.Min))))
+	if !ok { // 水印完全透明
+		return
+	}
+
+	// 水印偏亮时用黑色背景压暗，反之用白色背景提亮。
+	ratio := w.options.MinContrast
+	dark := contrast(lm, 0) >= contrast(lm, 1)
+	var target float64
+	if dark {
+		target = (lm+0.05)/ratio - 0.05
+	} else {
+		target = ratio*(lm+0.05) - 0.05
+	}
+	t := srgb(math.Max(0, math.Min(1, target)))
+
+	// draw.Over 混合的是 sRGB 编码之后的值，所以在编码空间中求解不透明度。
+	// 背景不均匀时，平均亮度与混合的结果并非严格对应，因此绘制之后重新测量，
+	// 仍未满足要求时再补上一层。
+	for i := 0; i < contrastPasses; i++ {
+		bg, _ := luminance(dst, r)
+		if contrast(lm, bg) >= ratio {
+			return
+		}
+
+		v := srgb(bg)
+		var c color.NRGBA
+		var alpha float64
+		if dark {
+			if v <= 0 { // 已无法再改善
+				return
+			}
+			alpha = 1 - t/v
+		} else {
+			if v >= 1 {
+				return
+			}
+			c = color.NRGBA{R: 255, G: 255, B: 255}
+			alpha = (t - v) / (1 - v)
+		}
+		c.A = uint8(math.Max(1, math.Ceil(math.Max(0, math.Min(1, alpha))*255)))
+
+		draw.Draw(dst, r, image.NewUniform(c), image.ZP, draw.Over)
+	}
+}
+
+// 返回 img 中 r 区域按透明度加权的平均相对亮度，取值 0-1。
+//
+// 若该区域完全透明，则 ok 返回 false。
+func luminance(img image.Image, r image.Rectangle) (l float64, ok bool) {
+	var sum, weight float64
+	for i := 0; i < luminanceSamples; i++ {
+		y := r.Min.Y + (2*i+1)*r.Dy()/(2*luminanceSamples)
+		for j := 0; j < luminanceSamples; j++ {
+			x := r.Min.X + (2*j+1)*r.Dx()/(2*luminanceSamples)
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			a := float64(c.A) / 0xffff
+			sum += a * (0.2126*linear(c.R) + 0.7152*linear(c.G) + 0.0722*linear(c.B))
+			weight += a
+		}
+	}
+
+	if weight == 0 {
+		return 0, false
+	}
+	return sum / weight, true
+}
+
+// 将 sRGB 分量转换为线性值
+func linear(v uint16) float64 {
+	c := float64(v) / 0xffff
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+// 将线性值转换为 sRGB 分量，是 linear 的逆运算，取值 0-1。
+func srgb(l float64) float64 {
+	if l <= 0.0031308 {
+		return l * 12.92
+	}
+	return 1.055*math.Pow(l, 1/2.4) - 0.055
+}
+
+// 返回两个相对亮度之间的对比度，取值 1-21。
+func contrast(l1, l2 float64) float64 {
+	if l1 < l2 {
+		l1, l2 = l2, l1
+	}
+	return (l1 + 0.05) / (l2 + 0.05)
+}
@@ -0,0 +1,58 @@
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestEnsureContrast(t *testing.T) {
+	tests := []struct {
+		mark   uint8 // 水印的灰度
+		bg     uint8 // 背景的灰度
+		split  bool  // 是否将背景的右半边设为与 bg 相反的灰度
+		ratio  float64
+		closer bool // 是否检测没有过度调整
+	}{
+		{mark: 20, bg: 40, ratio: 4.5, closer: true},
+		{mark: 20, bg: 60, ratio: 4.5, closer: true},
+		{mark: 20, bg: 100, ratio: 4.5, closer: true},
+		{mark: 235, bg: 150, ratio: 4.5, closer: true},
+		{mark: 235, bg: 250, ratio: 7, closer: true},
+		{mark: 128, bg: 128, ratio: 3, closer: true},
+		{mark: 20, bg: 10, split: true, ratio: 4.5},
+		{mark: 235, bg: 200, split: true, ratio: 4.5},
+	}
+
+	for _, tt := range tests {
+		mark := image.NewNRGBA(image.Rect(0, 0, 100, 50))
+		draw.Draw(mark, mark.Bounds(), image.NewUniform(color.Gray{Y: tt.mark}), image.ZP, draw.Src)
+
+		for _, dst := range []draw.Image{
+			image.NewRGBA(image.Rect(0, 0, 200, 100)),
+			image.NewNRGBA(image.Rect(0, 0, 200, 100)),
+			image.NewNRGBA64(image.Rect(0, 0, 200, 100)),
+		} {
+			draw.Draw(dst, dst.Bounds(), image.NewUniform(color.Gray{Y: tt.bg}), image.ZP, draw.Src)
+			if tt.split {
+				draw.Draw(dst, image.Rect(100, 0, 200, 100), image.NewUniform(color.Gray{Y: 255 - tt.bg}), image.ZP, draw.Src)
+			}
+
+			point := image.Pt(-50, -25)
+			w := NewFromImage(mark, &Options{MinContrast: tt.ratio})
+			w.ensureContrast(dst, mark, point)
+
+			r := image.Rect(50, 25, 150, 75)
+			lm, _ := luminance(mark, mark.Bounds())
+			bg, _ := luminance(dst, r)
+			got := contrast(lm, bg)
+			if got < tt.ratio {
+				t.Errorf("水印 %d，背景 %d，%T：对比度为 %.3f，应不低于 %g", tt.mark, tt.bg, dst, got, tt.ratio)
+			}
+			if tt.closer && got > tt.ratio*1.03 {
+				t.Errorf("水印 %d，背景 %d，%T：对比度为 %.3f，超出 %g 过多", tt.mark, tt.bg, dst, got, tt.ratio)
+			}
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package watermark
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// DefaultMaxPixels 未指定 Options.MaxPixels 时，允许解码的图片的最大像素数
+//
+// 对 Mark 和 MarkFile 同样有效，v1 中可以处理的超大图片，现在会返回 ErrImageTooLarge。
+const DefaultMaxPixels = 1 << 28
+
+// ErrImageTooLarge 图片尺寸超过限制
+var ErrImageTooLarge = errors.New("图片尺寸超过限制")
+
+// ErrInvalidImageSize 图片的宽或高不是正数
+var ErrInvalidImageSize = errors.New("无效的图片尺寸")
+
+// 读取目标图片的头信息，并检测尺寸是否在允许的范围之内，ext 必须为小写。
+//
+// 在真正解码之前调用，以免恶意构造的图片消耗大量内存。
+func (w *Watermark) decodeConfig(data []byte, ext string) (image.Config, error) {
+	conf, err := decodeConfig(bytes.NewReader(data), ext)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if conf.Width <= 0 || conf.Height <= 0 {
+		return image.Config{}, ErrInvalidImageSize
+	}
+
+	if int64(conf.Width)*int64(conf.Height) > w.maxPixels() {
+		return image.Config{}, ErrImageTooLarge
+	}
+	return conf, nil
+}
+
+// 允许解码的目标图片的最大像素数
+func (w *Watermark) maxPixels() int64 {
+	if w.options.MaxPixels <= 0 {
+		return DefaultMaxPixels
+	}
+	return w.options.MaxPixels
+}
+
+// 是否为文件被截断引起的错误
+//
+// image/jpeg 在扫描数据中遇到文件结尾时返回的是 FormatError("short Huffman data")。
+func isTruncated(err error) bool {
+	return errors.Is(err, io.ErrUnexpectedEOF) || err == jpeg.FormatError("short Huffman data")
+}
+
+// 根据 Watermark 的设置解码目标图片，ext 必须为小写。
+//
+// 应当先调用 decodeConfig 检测图片尺寸。
+func (w *Watermark) decode(data []byte, ext string) (image.Image, error) {
+	img, err := decode(bytes.NewReader(data), ext)
+	if err == nil || !w.options.Lenient || (ext != ".jpg" && ext != ".jpeg") || !isTruncated(err) {
+		return img, err
+	}
+
+	if img, e := decode(padJPEG(data), ext); e == nil {
+		return img, nil
+	}
+	return nil, err
+}
+
+// 根据扩展名 ext 解码图片，ext 必须为小写。
+//
+// 解码器内部的 panic 会被转换为错误返回。
+func decode(r io.Reader, ext string) (img image.Image, err error) {
+	defer func() {
+		if msg := recover(); msg != nil {
+			img, err = nil, fmt.Errorf("解码图片时发生错误：%v", msg)
+		}
+	}()
+
+	switch ext {
+	case ".jpg", ".jpeg":
+		return jpeg.Decode(r)
+	case ".png":
+		return png.Decode(r)
+	default:
+		return nil, ErrUnsupportedWatermarkType
+	}
+}
+
+// 根据扩展名 ext 读取图片头信息，ext 必须为小写。
+func decodeConfig(r io.Reader, ext string) (conf image.Config, err error) {
+	defer func() {
+		if msg := recover(); msg != nil {
+			conf, err = image.Config{}, fmt.Errorf("解码图片时发生错误：%v", msg)
+		}
+	}()
+
+	switch ext {
+	case ".jpg", ".jpeg":
+		return jpeg.DecodeConfig(r)
+	case ".png":
+		return png.DecodeConfig(r)
+	default:
+		return image.Config{}, ErrUnsupportedWatermarkType
+	}
+}
+
+// 为被截断的 JPEG 数据补齐扫描数据和结束标记。
+//
+// 补齐的零值字节按需生成，不会额外分配内存，其长度由 jpegPadding 计算；
+// 无法计算时只补上结束标记。
+func padJPEG(data []byte) io.Reader {
+	n, _ := jpegPadding(data)
+	return io.MultiReader(bytes.NewReader(data), io.LimitReader(zeroReader{}, n), bytes.NewReader([]byte{0xff, 0xd9}))
+}
+
+// 始终返回零值字节的 io.Reader
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// 返回被截断的 JPEG 数据 data 中，最后一段扫描数据在全部为零时最多还需要的字节数。
+//
+// 根据 SOF 中的尺寸和采样因子计算 MCU 的数量，根据 DHT 中的 Huffman 表计算
+// 全零的数据在每个块中最多消耗的位数。仅支持顺序编码的 JPEG，其它情况 ok 返回 false。
+func jpegPadding(data []byte) (n int64, ok bool) {
+	type component struct {
+		id, h, v int
+	}
+	type table struct {
+		length int  // 全零编码的位数
+		symbol byte // 全零编码对应的值
+	}
+
+	var width, height, hmax, vmax int
+	var comps []component
+	var tables [2][4]*table // DC 和 AC 表
+
+	// 跳过 SOI
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xff {
+			return 0, false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xff: // 填充字节
+			i++
+			continue
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd8: // 没有长度的标记
+			i += 2
+			continue
+		case marker == 0xd9: // EOI，数据并未被截断
+			return 0, false
+		}
+		length := int(data[i+2])<<8 | int(data[i+3])
+		if length < 2 || i+2+length > len(data) {
+			return 0, false
+		}
+		seg := data[i+4 : i+2+length]
+
+		switch marker {
+		case 0xc0, 0xc1: // 顺序编码的 SOF
+			if len(seg) < 6 || len(seg) < 6+3*int(seg[5]) {
+				return 0, false
+			}
+			height, width = int(seg[1])<<8|int(seg[2]), int(seg[3])<<8|int(seg[4])
+			comps = comps[:0]
+			for c := 0; c < int(seg[5]); c++ {
+				h, v := int(seg[7+3*c]>>4), int(seg[7+3*c]&0x0f)
+				if h == 0 || v == 0 {
+					return 0, false
+				}
+				comps = append(comps, component{id: int(seg[6+3*c]), h: h, v: v})
+				if h > hmax {
+					hmax = h
+				}
+				if v > vmax {
+					vmax = v
+				}
+			}
+		case 0xc2, 0xc3, 0xc5, 0xc6, 0xc7, 0xc9, 0xca, 0xcb, 0xcd, 0xce, 0xcf: // 其它编码方式
+			return 0, false
+		case 0xc4: // DHT
+			for len(seg) >= 17 {
+				class, id := seg[0]>>4, seg[0]&0x0f
+				if class > 1 || id > 3 {
+					return 0, false
+				}
+				t := &table{}
+				total := 0
+				for l := 0; l < 16; l++ {
+					if seg[1+l] > 0 && t.length == 0 {
+						t.length = l + 1
+					}
+					total += int(seg[1+l])
+				}
+				if total == 0 || len(seg) < 17+total {
+					return 0, false
+				}
+				t.symbol = seg[17]
+				tables[class][id] = t
+				seg = seg[17+total:]
+			}
+		case 0xda: // SOS
+			if len(seg) < 1 || len(seg) < 1+2*int(seg[0]) || len(comps) == 0 {
+				return 0, false
+			}
+
+			end := scanEnd(data, i+2+length)
+			if end < len(data) { // 完整的扫描数据，继续查找之后的段。
+				i = end
+				continue
+			}
+
+			var bits int64
+			var oneComp component
+			for c := 0; c < int(seg[0]); c++ {
+				id, sel := int(seg[1+2*c]), seg[2+2*c]
+				var comp *component
+				for k := range comps {
+					if comps[k].id == id {
+						comp = &comps[k]
+					}
+				}
+				dc, ac := tables[0][sel>>4&3], tables[1][sel&3]
+				if comp == nil || dc == nil || ac == nil {
+					return 0, false
+				}
+				oneComp = *comp
+				bits += int64(comp.h*comp.v) * blockBits(dc.length, dc.symbol, ac.length, ac.symbol)
+			}
+
+			var mcus int64
+			if seg[0] == 1 { // 非交错的扫描，每个 MCU 只有一个块
+				w := (width*oneComp.h + hmax - 1) / hmax
+				h := (height*oneComp.v + vmax - 1) / vmax
+				mcus = int64((w+7)/8) * int64((h+7)/8)
+				bits /= int64(oneComp.h * oneComp.v)
+			} else {
+				mcus = int64((width+8*hmax-1)/(8*hmax)) * int64((height+8*vmax-1)/(8*vmax))
+			}
+			return (mcus*bits+7)/8 + 1, true
+		}
+
+		i += 2 + length
+	}
+	return 0, false
+}
+
+// 返回从 start 开始的扫描数据之后的第一个标记的位置，一直到结尾都没有时返回 len(data)。
+func scanEnd(data []byte, start int) int {
+	for i := start; i+1 < len(data); i++ {
+		if data[i] == 0xff && data[i+1] != 0 && (data[i+1] < 0xd0 || data[i+1] > 0xd7) {
+			return i
+		}
+	}
+	return len(data)
+}
+
+// 返回全零的数据在一个块中最多消耗的位数，参数分别为 DC 和 AC 表中全零编码的位数及其对应的值。
+func blockBits(dcLength int, dcSymbol byte, acLength int, acSymbol byte) int64 {
+	bits := int64(dcLength) + int64(dcSymbol&0x0f)
+
+	// AC 系数一直对应同一个值，直到遇到 EOB 或是填满 63 个系数。
+	run, size := int(acSymbol>>4), int64(acSymbol&0x0f)
+	for k := 1; k < 64; {
+		bits += int64(acLength) + size
+		switch {
+		case size != 0:
+			k += run + 1
+		case run == 15: // ZRL
+			k += 16
+		default: // EOB
+			return bits
+		}
+	}
+	return bits
+}
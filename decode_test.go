@@ -0,0 +1,72 @@
+package watermark
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"testing"
+)
+
+func TestLenientTruncatedJPEG(t *testing.T) {
+	gray := new(bytes.Buffer)
+	if err := jpeg.Encode(gray, image.NewGray(image.Rect(0, 0, 300, 200)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mark := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	draw.Draw(mark, mark.Bounds(), image.NewUniform(color.White), image.ZP, draw.Src)
+
+	for name, data := range map[string][]byte{
+		"ycbcr": testImage(t, ".jpg", 300, 200),
+		"gray":  gray.Bytes(),
+	} {
+		sos := bytes.Index(data, []byte{0xff, 0xda})
+		for _, size := range []int{sos + 20, len(data) / 2, len(data) - 10} {
+			truncated := data[:size]
+
+			w := NewFromImage(mark, nil)
+			if err := w.MarkMIME(bytes.NewReader(truncated), io.Discard, "image/jpeg", image.Point{}); err == nil {
+				t.Errorf("%s/%d：未启用 Lenient 时应返回错误", name, size)
+			}
+
+			w = NewFromImage(mark, &Options{Lenient: true})
+			out := new(bytes.Buffer)
+			if err := w.MarkMIME(bytes.NewReader(truncated), out, "image/jpeg", image.Pt(-100, -50)); err != nil {
+				t.Errorf("%s/%d：%v", name, size, err)
+				continue
+			}
+			img, err := jpeg.Decode(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := img.Bounds().Size(); size != image.Pt(300, 200) {
+				t.Errorf("%s：图片尺寸为 %v", name, size)
+			}
+			if r, _, _, _ := img.At(110, 60).RGBA(); r < 0xf000 {
+				t.Errorf("%s/%d：水印处的像素为 %v", name, size, img.At(110, 60))
+			}
+		}
+
+		n, ok := jpegPadding(data[:sos+20])
+		if !ok || n <= 0 || n >= 300*200 {
+			t.Errorf("%s：补齐 %d 字节，%t", name, n, ok)
+		}
+	}
+}
+
+// FuzzMark 检测任意的输入数据都不会导致 panic 或是分配过多的内存
+func FuzzMark(f *testing.F) {
+	f.Add(testImage(f, ".jpg", 16, 16))
+	f.Add(testImage(f, ".png", 16, 16))
+	f.Add(testImage(f, ".jpg", 64, 48)[:100]) // 截断的 JPEG
+
+	w := NewFromImage(testMark(), &Options{Lenient: true, MaxPixels: 1 << 20})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, mimetype := range []string{"image/jpeg", "image/png"} {
+			w.MarkMIME(bytes.NewReader(data), io.Discard, mimetype, image.Point{})
+		}
+	})
+}
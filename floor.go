@@ -0,0 +1,66 @@
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// 以 Options.Floor 的不透明度，将水印平铺在整个 dst 上。
+//
+// 奇数行会偏移半个水印宽度，以免形成规则的网格，增加自动去除水印的难度。
+// 启用了 Options.FloorAdaptive 时，每一块都会在水印和其反色版本之间，
+// 选择与该处背景对比度更高的一个。
+func (w *Watermark) drawFloor(dst draw.Image, mark image.Image) {
+	a := math.Max(0, math.Min(1, w.options.Floor))
+	mask := image.NewUniform(color.Alpha16{A: uint16(a * 0xffff)})
+
+	b := dst.Bounds()
+	mb := mark.Bounds()
+	size := mb.Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return
+	}
+
+	var inverted image.Image
+	var lm, li float64
+	if w.options.FloorAdaptive {
+		var ok bool
+		if lm, ok = luminance(mark, mb); !ok { // 水印完全透明
+			return
+		}
+		inverted = invert(mark)
+		li, _ = luminance(inverted, mb)
+	}
+
+	for row, y := 0, b.Min.Y; y < b.Max.Y; row, y = row+1, y+size.Y {
+		x := b.Min.X
+		if row%2 == 1 {
+			x -= size.X / 2
+		}
+		for ; x < b.Max.X; x += size.X {
+			r := image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x, y).Add(size)}
+			tile := mark
+			if inverted != nil {
+				if bg, _ := luminance(dst, r.Intersect(b)); contrast(li, bg) > contrast(lm, bg) {
+					tile = inverted
+				}
+			}
+			draw.DrawMask(dst, r, tile, mb.Min, mask, image.ZP, draw.Over)
+		}
+	}
+}
+
+// 返回 img 的反色副本，透明度保持不变。
+func invert(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			dst.SetNRGBA(x, y, color.NRGBA{R: 255 - c.R, G: 255 - c.G, B: 255 - c.B, A: c.A})
+		}
+	}
+	return dst
+}
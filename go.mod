@@ -0,0 +1,3 @@
+module github.com/hard88/watermark/v2
+
+go 1.19
@@ -0,0 +1,100 @@
+package watermark
+
+import (
+	"encoding/json"
+	"image"
+	"os"
+)
+
+// ReadSidecar 读取 path 指定的 .wm.json 文件
+func ReadSidecar(path string) (*Sidecar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sidecar{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Heatmap 根据 .wm.json 文件统计水印的放置位置，并绘制为 width*height 大小的热力图
+//
+// reports 为 .wm.json 文件的路径，即 SidecarPath 的返回值，比如 photo.jpg.wm.json；
+// 其中记录的输出文件必须存在，用于获取输出图片的尺寸；
+// 各个输出图片会按比例缩放到热力图的大小，越亮表示该处被水印覆盖的次数越多，
+// 未打水印的记录会被忽略。返回的图片也可以作为 Saliency 的显著性图使用。
+func Heatmap(reports []string, width, height int) (*image.Gray, error) {
+	if width <= 0 || height <= 0 {
+		panic("参数 width 和 height 必须大于 0")
+	}
+
+	counts := make([]int, width*height)
+	for _, report := range reports {
+		s, err := ReadSidecar(report)
+		if err != nil {
+			return nil, err
+		}
+		if s.Width == 0 || s.Height == 0 {
+			continue
+		}
+
+		size, err := imageSize(s.Output)
+		if err != nil {
+			return nil, err
+		}
+
+		r := image.Rect(s.X*width/size.X, s.Y*height/size.Y,
+			ceilDiv((s.X+s.Width)*width, size.X), ceilDiv((s.Y+s.Height)*height, size.Y))
+		r = r.Intersect(image.Rect(0, 0, width, height))
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				counts[y*width+x]++
+			}
+		}
+	}
+
+	highest := 0
+	for _, c := range counts {
+		if c > highest {
+			highest = c
+		}
+	}
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	if highest == 0 {
+		return img, nil
+	}
+	for i, c := range counts {
+		img.Pix[i] = uint8(c * 255 / highest)
+	}
+	return img, nil
+}
+
+// 返回图片文件 path 的尺寸
+func imageSize(path string) (image.Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return image.Point{}, err
+	}
+	defer f.Close()
+
+	conf, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return image.Point{}, err
+	}
+	if conf.Width <= 0 || conf.Height <= 0 {
+		return image.Point{}, ErrInvalidImageSize
+	}
+	return image.Pt(conf.Width, conf.Height), nil
+}
+
+// 向上取整的除法，b 必须为正数。
+func ceilDiv(a, b int) int {
+	if a <= 0 {
+		return a / b
+	}
+	return (a + b - 1) / b
+}
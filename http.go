@@ -0,0 +1,109 @@
+package watermark
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// Handler 返回接收 multipart 表单上传的图片，并将打上水印之后的图片直接返回的 http.Handler
+//
+// field 为图片所在的表单字段名，maxBytes 为请求内容的最大字节数，pos 用于计算水印位置。
+// 表单按顺序逐段读取，不会写入临时文件，内存占用由 maxBytes 和 Options.MaxPixels 共同限定。
+// 图片类型优先取该字段的 Content-Type，无法识别时根据内容判断。
+// 开始返回图片之后若编码或写入失败，会以 http.ErrAbortHandler 中断连接。
+func (w *Watermark) Handler(field string, maxBytes int64, pos PositionFunc) http.Handler {
+	if maxBytes <= 0 {
+		panic("参数 maxBytes 必须大于 0")
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			rw.Header().Set("Allow", "POST, PUT")
+			http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.ContentLength > maxBytes {
+			http.Error(rw, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(rw, r.Body, maxBytes)
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				http.Error(rw, "缺少表单字段 "+field, http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				httpError(rw, err)
+				return
+			}
+
+			if part.FormName() != field {
+				part.Close()
+				continue
+			}
+
+			started, err := w.markPart(rw, part, pos)
+			part.Close()
+			if err != nil && started {
+				// 状态码和部分图片内容可能已经发出，无法再返回错误，只能中断连接。
+				panic(http.ErrAbortHandler)
+			}
+			if err != nil {
+				httpError(rw, err)
+			}
+			return
+		}
+	})
+}
+
+// 给表单中的图片打上水印，并写入 rw。
+//
+// 只有在水印绘制成功之后才会写入报头，之前的错误仍可以正常返回错误状态码；
+// started 表示是否已经开始写入响应，此时的错误无法再通过状态码返回。
+func (w *Watermark) markPart(rw http.ResponseWriter, part *multipart.Part, pos PositionFunc) (started bool, err error) {
+	br := bufio.NewReader(part)
+
+	mimetype := part.Header.Get("Content-Type")
+	if !IsAllowMIME(mimetype) {
+		head, _ := br.Peek(512)
+		mimetype = http.DetectContentType(head)
+	}
+
+	ext := mimeExt(mimetype)
+	if ext == "" {
+		return false, ErrUnsupportedWatermarkType
+	}
+
+	meta := FileMeta{Ext: ext}
+	err = w.markTo(br, meta, point(pos, meta), nil, w.outputExt(ext), func() (io.Writer, error) {
+		started = true
+		rw.Header().Set("Content-Type", w.OutputMIME(mimetype))
+		return rw, nil
+	})
+	return started, err
+}
+
+// 根据错误类型返回相应的状态码
+func httpError(rw http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge), errors.Is(err, ErrImageTooLarge):
+		http.Error(rw, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrUnsupportedWatermarkType):
+		http.Error(rw, err.Error(), http.StatusUnsupportedMediaType)
+	default:
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,64 @@
+package watermark
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 返回在 file 字段中上传 data 的请求
+func uploadRequest(t *testing.T, data []byte) *http.Request {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", "photo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestHandler(t *testing.T) {
+	w := NewFromImage(testMark(), nil)
+	rec := httptest.NewRecorder()
+	w.Handler("file", 1<<20, Anchor(BottomRight, 0)).ServeHTTP(rec, uploadRequest(t, testImage(t, ".png", 300, 200)))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("状态码为 %d，类型为 %s：%s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(300, 200) {
+		t.Errorf("图片尺寸为 %v", size)
+	}
+}
+
+func TestHandlerAbort(t *testing.T) {
+	// 无效的元数据直到编码时才会发现，此时已经调用了 dst。
+	w := NewFromImage(testMark(), &Options{Metadata: func(FileMeta) map[string]string {
+		return map[string]string{"": "x"}
+	}})
+	rec := httptest.NewRecorder()
+
+	defer func() {
+		if msg := recover(); msg != http.ErrAbortHandler {
+			t.Fatalf("应以 http.ErrAbortHandler 中断，实际为 %v", msg)
+		}
+		if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+			t.Errorf("不应写入错误信息：%d %q", rec.Code, rec.Body.String())
+		}
+	}()
+	w.Handler("file", 1<<20, Anchor(BottomRight, 0)).ServeHTTP(rec, uploadRequest(t, testImage(t, ".png", 300, 200)))
+}
@@ -0,0 +1,137 @@
+package watermark
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Loader 根据 key 加载对应的 Watermark 对象
+type Loader func(key string) (*Watermark, error)
+
+// Manager 按需加载并缓存多个 Watermark 对象
+//
+// 适用于多租户等需要管理大量水印的场景：缓存数量超过上限时，
+// 淘汰最久未使用的对象；超过有效期的对象会在下次访问时重新加载。
+type Manager struct {
+	loader Loader
+	size   int
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List // 越靠前的元素越近被访问
+	stats Stats
+}
+
+// Stats Manager 的缓存统计信息
+type Stats struct {
+	Hits      uint64 // 命中缓存的次数
+	Misses    uint64 // 未命中缓存而调用 Loader 的次数
+	Evictions uint64 // 因数量超限或是过期而被淘汰的数量
+	Len       int    // 当前缓存的数量
+}
+
+type entry struct {
+	key     string
+	w       *Watermark
+	expires time.Time // 为零值表示永不过期
+}
+
+// NewManager 声明一个 Manager 对象
+//
+// size 为最多缓存的对象数量，必须大于 0；
+// ttl 为每个对象的有效期，0 表示永不过期；
+// loader 用于加载未在缓存中的对象。
+func NewManager(size int, ttl time.Duration, loader Loader) *Manager {
+	if size <= 0 {
+		panic("参数 size 必须大于 0")
+	}
+
+	if loader == nil {
+		panic("参数 loader 不能为空")
+	}
+
+	return &Manager{
+		loader: loader,
+		size:   size,
+		ttl:    ttl,
+		items:  make(map[string]*list.Element, size),
+		lru:    list.New(),
+	}
+}
+
+// Get 返回 key 对应的 Watermark 对象，若不在缓存中，则调用 Loader 加载。
+func (m *Manager) Get(key string) (*Watermark, error) {
+	m.mu.Lock()
+	if elem, found := m.items[key]; found {
+		e := elem.Value.(*entry)
+		if e.expires.IsZero() || time.Now().Before(e.expires) {
+			m.lru.MoveToFront(elem)
+			m.stats.Hits++
+			m.mu.Unlock()
+			return e.w, nil
+		}
+		m.remove(elem)
+		m.stats.Evictions++
+	}
+	m.stats.Misses++
+	m.mu.Unlock()
+
+	// 加载过程可能比较耗时，不应阻塞对其它 key 的访问。
+	w, err := m.loader(key)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 并发加载同一 key 时，以先存入的为准。
+	if elem, found := m.items[key]; found {
+		m.lru.MoveToFront(elem)
+		return elem.Value.(*entry).w, nil
+	}
+
+	e := &entry{key: key, w: w}
+	if m.ttl > 0 {
+		e.expires = time.Now().Add(m.ttl)
+	}
+	m.items[key] = m.lru.PushFront(e)
+
+	for m.lru.Len() > m.size {
+		m.remove(m.lru.Back())
+		m.stats.Evictions++
+	}
+
+	return w, nil
+}
+
+// Remove 从缓存中删除 key 对应的对象
+func (m *Manager) Remove(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, found := m.items[key]; found {
+		m.remove(elem)
+	}
+}
+
+// Stats 返回缓存的统计信息
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stats
+	s.Len = m.lru.Len()
+	return s
+}
+
+// 删除元素并释放其水印图片，调用方需要持有锁。
+//
+// 正在使用该对象的调用不受影响，Close 之后的再次使用会重新加载水印图片。
+func (m *Manager) remove(elem *list.Element) {
+	e := m.lru.Remove(elem).(*entry)
+	delete(m.items, e.key)
+	e.w.Close()
+}
@@ -0,0 +1,199 @@
+package watermark
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// ErrInvalidMetadata Options.Metadata 返回的内容无法写入输出图片
+var ErrInvalidMetadata = errors.New("无效的元数据")
+
+// 调用 write 将图片写入 dst，并在其中插入 Options.Metadata 返回的内容，ext 为输出图片的扩展名。
+//
+// PNG 的元数据以 tEXt 块写在 IHDR 之后，含非 ASCII 字符时使用 iTXt 块；
+// JPEG 的元数据以 key=value 形式的 COM 段写在 SOI 及所有 APPn 段之后；其它格式忽略元数据。
+func (w *Watermark) writeMetadata(dst io.Writer, meta FileMeta, ext string, write func(io.Writer) error) error {
+	if w.options.Metadata == nil {
+		return write(dst)
+	}
+
+	m := w.options.Metadata(meta)
+	if len(m) == 0 {
+		return write(dst)
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var payload []byte
+	var split func([]byte) (int, bool)
+	switch ext {
+	case ".png":
+		for _, k := range keys {
+			chunk, err := pngText(k, m[k])
+			if err != nil {
+				return err
+			}
+			payload = append(payload, chunk...)
+		}
+		split = pngSplit
+	case ".jpg", ".jpeg":
+		for _, k := range keys {
+			seg, err := jpegComment(k, m[k])
+			if err != nil {
+				return err
+			}
+			payload = append(payload, seg...)
+		}
+		split = jpegSplit
+	default:
+		return write(dst)
+	}
+
+	mw := &metadataWriter{w: dst, payload: payload, split: split}
+	if err := write(mw); err != nil {
+		return err
+	}
+	return mw.flush()
+}
+
+// 在输出内容的指定位置插入元数据的 io.Writer
+//
+// 在 split 确定插入位置之前，写入的内容会暂存在 buf 中。
+type metadataWriter struct {
+	w       io.Writer
+	buf     []byte
+	payload []byte
+	split   func([]byte) (int, bool)
+}
+
+func (w *metadataWriter) Write(p []byte) (int, error) {
+	if w.payload == nil {
+		return w.w.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	n, ok := w.split(w.buf)
+	if !ok {
+		return len(p), nil
+	}
+
+	if n >= 0 {
+		if _, err := w.w.Write(w.buf[:n]); err != nil {
+			return 0, err
+		}
+		if _, err := w.w.Write(w.payload); err != nil {
+			return 0, err
+		}
+	} else {
+		n = 0
+	}
+	_, err := w.w.Write(w.buf[n:])
+	w.buf, w.payload = nil, nil
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// 写入未能确定插入位置的剩余内容，此时不再插入元数据。
+func (w *metadataWriter) flush() error {
+	if w.payload == nil || len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.w.Write(w.buf)
+	w.buf, w.payload = nil, nil
+	return err
+}
+
+// PNG 文件头和 IHDR 块的总长度
+const pngHeaderSize = 8 + 4 + 4 + 13 + 4
+
+// 返回 PNG 中 IHDR 块之后的位置，无效的数据返回 -1。
+func pngSplit(b []byte) (int, bool) {
+	if len(b) < pngHeaderSize {
+		return 0, false
+	}
+	if string(b[1:4]) != "PNG" || string(b[12:16]) != "IHDR" {
+		return -1, true
+	}
+	return pngHeaderSize, true
+}
+
+// 返回 JPEG 中 SOI 和所有 APPn 段之后的位置，无效的数据返回 -1。
+func jpegSplit(b []byte) (int, bool) {
+	if len(b) < 2 {
+		return 0, false
+	}
+	if b[0] != 0xff || b[1] != 0xd8 {
+		return -1, true
+	}
+
+	i := 2
+	for {
+		if len(b) < i+4 {
+			return 0, false
+		}
+		if b[i] != 0xff || b[i+1] < 0xe0 || b[i+1] > 0xef {
+			return i, true
+		}
+		i += 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+	}
+}
+
+// 返回以 key 为关键字、value 为内容的 PNG tEXt 块，含非 ASCII 字符时返回 iTXt 块。
+func pngText(key, value string) ([]byte, error) {
+	if key == "" || len(key) > 79 || !isASCII(key) || !utf8.ValidString(value) {
+		return nil, ErrInvalidMetadata
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] == 0 {
+			return nil, ErrInvalidMetadata
+		}
+	}
+
+	typ, data := "tEXt", append([]byte(key), 0)
+	if isASCII(value) {
+		data = append(data, value...)
+	} else {
+		// 不压缩，不指定语言和翻译后的关键字
+		typ = "iTXt"
+		data = append(data, 0, 0, 0, 0)
+		data = append(data, value...)
+	}
+
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:])), nil
+}
+
+// 是否仅包含 ASCII 字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// 返回内容为 key=value 的 JPEG COM 段
+func jpegComment(key, value string) ([]byte, error) {
+	text := key + "=" + value
+	if key == "" || len(text) > 0xffff-2 {
+		return nil, ErrInvalidMetadata
+	}
+
+	seg := []byte{0xff, 0xfe, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(text)+2))
+	return append(seg, text...), nil
+}
@@ -0,0 +1,69 @@
+package watermark
+
+import (
+	"image"
+	"io"
+	"mime"
+)
+
+// 允许做水印的 MIME 类型及其对应的扩展名
+var allowMIMEs = map[string]string{
+	"image/jpeg":  ".jpg",
+	"image/pjpeg": ".jpg",
+	"image/png":   ".png",
+}
+
+// IsAllowMIME 该 MIME 类型的图片是否允许使用水印
+//
+// mimetype 可以带参数，比如 Content-Type 报头中的 image/png; charset=binary。
+func IsAllowMIME(mimetype string) bool {
+	return mimeExt(mimetype) != ""
+}
+
+// MarkMIME 将水印写入 src 中，并将结果写入 dst，由 mimetype 确定当前图片的类型。
+//
+// 设置了 Options.Format 时，输出图片的格式会随之改变，可通过 OutputMIME 获取对应的类型。
+//
+// 适用于只有 Content-Type 而没有扩展名的场景，比如 HTTP 服务。
+func (w *Watermark) MarkMIME(src io.Reader, dst io.Writer, mimetype string, point image.Point) error {
+	ext := mimeExt(mimetype)
+	if ext == "" {
+		return ErrUnsupportedWatermarkType
+	}
+
+	return w.markTo(src, FileMeta{Ext: ext}, func(_, _ image.Rectangle) image.Point {
+		return point
+	}, nil, w.outputExt(ext), func() (io.Writer, error) {
+		return dst, nil
+	})
+}
+
+// OutputMIME 返回 MarkMIME 处理 mimetype 类型的图片时，输出图片的 MIME 类型
+//
+// 不支持的类型返回空值。
+func (w *Watermark) OutputMIME(mimetype string) string {
+	ext := mimeExt(mimetype)
+	if ext == "" {
+		return ""
+	}
+
+	switch w.outputExt(ext) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	default:
+		return ""
+	}
+}
+
+// 返回 mimetype 对应的扩展名，不支持的类型返回空值。
+func mimeExt(mimetype string) string {
+	t, _, err := mime.ParseMediaType(mimetype)
+	if err != nil {
+		return ""
+	}
+	return allowMIMEs[t]
+}
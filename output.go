@@ -0,0 +1,166 @@
+package watermark
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// NameData 输出文件名模板中可用的数据
+type NameData struct {
+	Stem string // 源文件不含扩展名的文件名
+	Ext  string // 源文件的扩展名，带 . 符号
+	Date string // 当前日期，格式为 20060102
+}
+
+// OutputName 根据模板 tmpl 生成 path 对应的输出文件路径
+//
+// tmpl 为 text/template 格式的模板，可用字段参考 NameData，
+// 比如 {{.Stem}}_wm_{{.Date}}{{.Ext}}。生成的文件与 path 位于同一目录下。
+//
+// 为了在各个平台之间共享文件，生成的文件名会调整为 Windows 下同样有效的名称：
+// 无效的字符替换为 _，去掉末尾的点和空格，CON、NUL、COM1 等保留名称后面加上 _。
+func OutputName(tmpl, path string) (string, error) {
+	t, err := template.New("output").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	data := &NameData{
+		Stem: strings.TrimSuffix(base, ext),
+		Ext:  ext,
+		Date: time.Now().Format("20060102"),
+	}
+
+	buf := new(bytes.Buffer)
+	if err = t.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), portableName(buf.String())), nil
+}
+
+// Windows 下的保留名称，无论是否带扩展名都不能用作文件名。
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// 将文件名 name 调整为在 Windows 下同样有效的名称
+func portableName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ")
+
+	stem := name
+	if i := strings.IndexByte(stem, '.'); i >= 0 {
+		stem = stem[:i]
+	}
+	if reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		name = stem + "_" + name[len(stem):]
+	}
+
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// MarkFileTo 给文件 src 打上水印，并保存到 dst，src 本身保持不变。
+//
+// 输出的图片格式由 Options.Format 指定，默认与 src 相同。dst 已经存在时，按 Options.Collision 处理。
+// 返回值为实际写入的文件路径，若因 dst 已经存在而跳过，则返回空字符串。
+// 输出文件仅在水印绘制成功之后才会创建，若编码或写入失败，则会被删除。
+func (w *Watermark) MarkFileTo(src, dst string, point image.Point) (string, error) {
+	if w.options.Collision == Skip {
+		if _, err := os.Stat(dst); err == nil {
+			return "", nil
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	var out *os.File
+	var r image.Rectangle
+	h := w.outputHash()
+	meta := FileMeta{Path: src, Ext: strings.ToLower(filepath.Ext(src))}
+	err = w.markTo(in, meta, func(_, _ image.Rectangle) image.Point {
+		return point
+	}, &r, w.outputExt(meta.Ext), func() (io.Writer, error) {
+		out, err = w.options.Collision.create(dst)
+		if out == nil && err == nil {
+			return io.Discard, nil
+		}
+		return hashWriter(out, h), err
+	})
+
+	if out == nil { // 出错或是跳过时，尚未创建输出文件
+		return "", err
+	}
+
+	// 关闭失败时，写入的内容可能并不完整，不能当作成功处理。
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(out.Name()) // 不保留只写入了部分内容的文件
+		return "", err
+	}
+	return out.Name(), w.writeSidecar(src, out.Name(), r, h)
+}
+
+// Collision 输出文件已经存在时的处理方式
+type Collision int
+
+// 各类处理方式
+const (
+	Overwrite Collision = iota // 覆盖已有的文件
+	Skip                       // 跳过，不写入任何内容
+	Rename                     // 在文件名之后添加 _1、_2 等后缀，直到不与已有文件冲突
+)
+
+// 按处理方式创建输出文件，若需要跳过，则返回 nil, nil。
+func (c Collision) create(path string) (*os.File, error) {
+	switch c {
+	case Overwrite:
+		return os.Create(path)
+	case Skip:
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			return nil, nil
+		}
+		return f, err
+	case Rename:
+		ext := filepath.Ext(path)
+		stem := strings.TrimSuffix(path, ext)
+		for i := 0; ; i++ {
+			name := path
+			if i > 0 {
+				name = stem + "_" + strconv.Itoa(i) + ext
+			}
+
+			f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+			if !os.IsExist(err) {
+				return f, err
+			}
+		}
+	default:
+		panic("无效的 Collision 值")
+	}
+}
@@ -0,0 +1,64 @@
+package watermark
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPortableName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"photo.jpg", "photo.jpg"},
+		{"照片.jpg", "照片.jpg"},
+		{"con.jpg", "con_.jpg"},
+		{"CON", "CON_"},
+		{"LPT1.tar.gz", "LPT1_.tar.gz"},
+		{"aux .png", "aux _.png"},
+		{"COM10.png", "COM10.png"},
+		{"console.png", "console.png"},
+		{"photo. ", "photo"},
+		{"photo.jpg...", "photo.jpg"},
+		{"a:b?.png", "a_b_.png"},
+		{"a<b>|*\"\\.png", "a_b_____.png"},
+		{"tab\t.png", "tab_.png"},
+		{"", "_"},
+		{". .", "_"},
+	}
+
+	for _, tt := range tests {
+		if got := portableName(tt.name); got != tt.want {
+			t.Errorf("portableName(%q) = %q，应为 %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	dir := filepath.Join("photos", "2024")
+	tests := []struct {
+		tmpl, path, want string
+	}{
+		{"{{.Stem}}_wm{{.Ext}}", "photo.jpg", "photo_wm.jpg"},
+		{"{{.Stem}}{{.Ext}}", "con.jpg", "con_.jpg"},
+		{"{{.Stem}}", "CON.png", "CON_"},
+		{"{{.Stem}}{{.Ext}}", "LPT1.tar.gz", "LPT1_.tar.gz"},
+		{"{{.Stem}}. ", "photo.png", "photo"},
+		{"a:b?{{.Ext}}", "photo.png", "a_b_.png"},
+		{"{{.Stem}}/{{.Ext}}", "photo.png", "photo_.png"},
+		{"", "photo.png", "_"},
+	}
+
+	for _, tt := range tests {
+		got, err := OutputName(tt.tmpl, filepath.Join(dir, tt.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(dir, tt.want); got != want {
+			t.Errorf("OutputName(%q, %q) = %q，应为 %q", tt.tmpl, tt.path, got, want)
+		}
+	}
+
+	if _, err := OutputName("{{.Stem", "photo.png"); err == nil {
+		t.Error("无效的模板应返回错误")
+	}
+}
@@ -0,0 +1,40 @@
+package watermark
+
+import (
+	"image"
+	"image/draw"
+	"runtime"
+	"sync"
+)
+
+// 水印与目标图片的重叠区域超过该像素数时，才按条带并行合成。
+const parallelPixels = 1 << 20
+
+// 将水印 mark 叠加到 dst 上，point 为与 dst 左上角对齐的水印起点。
+//
+// 重叠区域较大时，会将其切分为多个水平条带，由多个 goroutine 同时合成。
+func drawOver(dst draw.Image, mark image.Image, point image.Point) {
+	b := dst.Bounds()
+	r := b.Intersect(mark.Bounds().Add(b.Min.Sub(point)))
+
+	n := runtime.GOMAXPROCS(0)
+	if n > r.Dy() {
+		n = r.Dy()
+	}
+	if n < 2 || r.Dx()*r.Dy() < parallelPixels {
+		draw.Draw(dst, b, mark, point, draw.Over)
+		return
+	}
+
+	var wg sync.WaitGroup
+	height := (r.Dy() + n - 1) / n
+	for y := r.Min.Y; y < r.Max.Y; y += height {
+		band := image.Rect(r.Min.X, y, r.Max.X, y+height).Intersect(r)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			draw.Draw(dst, band, mark, point.Add(band.Min.Sub(b.Min)), draw.Over)
+		}()
+	}
+	wg.Wait()
+}
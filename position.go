@@ -0,0 +1,187 @@
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// FileMeta 目标图片的相关信息
+type FileMeta struct {
+	Path string // 文件路径，仅在处理文件时才有值
+	Ext  string // 小写的扩展名，带 . 符号
+}
+
+// PositionFunc 根据目标图片计算水印位置的函数
+//
+// srcBounds 为目标图片的范围，markBounds 为水印图片的范围，
+// 返回值为水印左上角在目标图片中的坐标。
+type PositionFunc func(srcBounds, markBounds image.Rectangle, meta FileMeta) image.Point
+
+// MarkFileFunc 给指定的文件打上水印，水印位置由 pos 计算得出。
+func (w *Watermark) MarkFileFunc(path string, pos PositionFunc) error {
+	return w.markFile(path, func(srcBounds, markBounds image.Rectangle, meta FileMeta) image.Point {
+		return point(pos, meta)(srcBounds, markBounds)
+	})
+}
+
+// MarkFunc 将水印写入 src 中，由 ext 确定当前图片的类型，水印位置由 pos 计算得出。
+func (w *Watermark) MarkFunc(src io.ReadWriteSeeker, ext string, pos PositionFunc) error {
+	meta := FileMeta{Ext: strings.ToLower(ext)}
+	return w.mark(src, meta, point(pos, meta))
+}
+
+// 将 pos 返回的水印坐标转换为 draw 所需的水印起点
+func point(pos PositionFunc, meta FileMeta) func(srcBounds, markBounds image.Rectangle) image.Point {
+	return func(srcBounds, markBounds image.Rectangle) image.Point {
+		p := pos(srcBounds, markBounds, meta)
+		return markBounds.Min.Add(srcBounds.Min).Sub(p)
+	}
+}
+
+// Pos 水印在目标图片中的位置
+type Pos int
+
+// 水印的各个位置
+const (
+	TopLeft Pos = iota
+	TopRight
+	BottomLeft
+	BottomRight
+	Center
+)
+
+// Anchor 返回将水印放置于 pos 位置的 PositionFunc
+//
+// padding 为水印与目标图片边缘的留白大小，对 Center 无效。
+func Anchor(pos Pos, padding int) PositionFunc {
+	if pos < TopLeft || pos > Center {
+		panic("无效的参数 pos")
+	}
+
+	return func(srcBounds, markBounds image.Rectangle, meta FileMeta) image.Point {
+		start := srcBounds.Min
+		end := srcBounds.Max.Sub(markBounds.Size())
+
+		switch pos {
+		case TopLeft:
+			return start.Add(image.Pt(padding, padding))
+		case TopRight:
+			return image.Pt(end.X-padding, start.Y+padding)
+		case BottomLeft:
+			return image.Pt(start.X+padding, end.Y-padding)
+		case BottomRight:
+			return end.Sub(image.Pt(padding, padding))
+		default: // Center
+			return start.Add(end).Div(2)
+		}
+	}
+}
+
+// Percent 返回按百分比放置水印的 PositionFunc
+//
+// x 和 y 为水印在水平和垂直方向上可移动范围内的百分比，取值 0-100，
+// 比如 (0, 0) 表示左上角，(50, 50) 表示居中，(100, 100) 表示右下角。
+func Percent(x, y float64) PositionFunc {
+	if x < 0 || x > 100 || y < 0 || y > 100 {
+		panic("参数 x 和 y 的取值范围为 0-100")
+	}
+
+	return func(srcBounds, markBounds image.Rectangle, meta FileMeta) image.Point {
+		free := srcBounds.Size().Sub(markBounds.Size())
+		return srcBounds.Min.Add(image.Pt(int(float64(free.X)*x/100), int(float64(free.Y)*y/100)))
+	}
+}
+
+// 计算显著性时，每个候选区域在水平和垂直方向上的采样点数量。
+const saliencySamples = 32
+
+// Saliency 返回根据显著性图选择水印位置的 PositionFunc
+//
+// m 为目标图片的显著性图，以灰度表示各处的重要程度，越亮越重要，
+// 其尺寸可以与目标图片不同，会按比例对应到目标图片上。
+// 会在 TopLeft、TopRight、BottomLeft、BottomRight 和 Center 中，
+// 选择水印所覆盖区域的平均重要程度最低的位置，padding 的含义与 Anchor 相同。
+func Saliency(m image.Image, padding int) PositionFunc {
+	anchors := make([]PositionFunc, 0, Center+1)
+	for pos := TopLeft; pos <= Center; pos++ {
+		anchors = append(anchors, Anchor(pos, padding))
+	}
+
+	return func(srcBounds, markBounds image.Rectangle, meta FileMeta) image.Point {
+		var best image.Point
+		lowest := -1.0
+		for _, anchor := range anchors {
+			p := anchor(srcBounds, markBounds, meta)
+			r := image.Rectangle{Min: p, Max: p.Add(markBounds.Size())}
+			if v := saliency(m, srcBounds, r); lowest < 0 || v < lowest {
+				best, lowest = p, v
+			}
+		}
+		return best
+	}
+}
+
+// 返回显著性图 m 中与目标图片区域 r 对应部分的平均灰度值
+func saliency(m image.Image, srcBounds, r image.Rectangle) float64 {
+	r = r.Intersect(srcBounds)
+	if r.Empty() {
+		return 0
+	}
+
+	mb := m.Bounds()
+	var sum float64
+	for i := 0; i < saliencySamples; i++ {
+		y := r.Min.Y + (2*i+1)*r.Dy()/(2*saliencySamples)
+		my := mb.Min.Y + (y-srcBounds.Min.Y)*mb.Dy()/srcBounds.Dy()
+		for j := 0; j < saliencySamples; j++ {
+			x := r.Min.X + (2*j+1)*r.Dx()/(2*saliencySamples)
+			mx := mb.Min.X + (x-srcBounds.Min.X)*mb.Dx()/srcBounds.Dx()
+			sum += float64(color.Gray16Model.Convert(m.At(mx, my)).(color.Gray16).Y)
+		}
+	}
+	return sum / (saliencySamples * saliencySamples)
+}
+
+// Aspect 目标图片的宽高比类别
+type Aspect int
+
+// 各类宽高比
+const (
+	Square    Aspect = iota // 宽高比在 10:11 到 11:10 之间
+	Landscape               // 横向图片
+	Portrait                // 纵向图片
+	Panorama                // 宽度至少为高度两倍的全景图片
+)
+
+// AspectOf 返回 r 所属的宽高比类别
+func AspectOf(r image.Rectangle) Aspect {
+	w, h := r.Dx(), r.Dy()
+	switch {
+	case w >= 2*h:
+		return Panorama
+	case 10*w > 11*h:
+		return Landscape
+	case 10*h > 11*w:
+		return Portrait
+	default:
+		return Square
+	}
+}
+
+// ByAspect 返回根据目标图片的宽高比类别选择不同 PositionFunc 的函数
+//
+// layouts 中不存在对应类别时，使用 fallback。
+func ByAspect(layouts map[Aspect]PositionFunc, fallback PositionFunc) PositionFunc {
+	if fallback == nil {
+		panic("参数 fallback 不能为空")
+	}
+
+	return func(srcBounds, markBounds image.Rectangle, meta FileMeta) image.Point {
+		if pos, found := layouts[AspectOf(srcBounds)]; found {
+			return pos(srcBounds, markBounds, meta)
+		}
+		return fallback(srcBounds, markBounds, meta)
+	}
+}
@@ -0,0 +1,283 @@
+package watermark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNoRAWPreview RAW 文件中没有可用的 JPEG 预览图
+var ErrNoRAWPreview = errors.New("RAW 文件中没有可用的预览图")
+
+// 支持提取预览图的 RAW 类型
+var rawExts = []string{
+	".cr2", ".nef", ".arw",
+}
+
+// 以下为 TIFF 中与预览图相关的标签
+const (
+	tagCompression     = 0x0103
+	tagStripOffsets    = 0x0111
+	tagStripByteCounts = 0x0117
+	tagSubIFDs         = 0x014a
+	tagJPEGOffset      = 0x0201
+	tagJPEGLength      = 0x0202
+	tagExifIFD         = 0x8769
+)
+
+// 读取 IFD 的最大数量，防止损坏的文件形成环。
+const maxIFDs = 64
+
+// IsRAWExt 该扩展名是否为支持提取预览图的 RAW 格式
+//
+// ext 必须带上 . 符号
+func IsRAWExt(ext string) bool {
+	if ext == "" {
+		panic("参数 ext 不能为空")
+	}
+
+	if ext[0] != '.' {
+		panic("参数 ext 必须以 . 开头")
+	}
+
+	ext = strings.ToLower(ext)
+
+	for _, e := range rawExts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkRAWFile 提取 RAW 文件 src 中内嵌的预览图，打上水印后以 JPEG 格式保存到 dst。
+//
+// dst 仅在水印绘制成功之后才会创建，若编码失败，则会删除已经写入了部分内容的 dst。
+func (w *Watermark) MarkRAWFile(src, dst string, point image.Point) (err error) {
+	ext := filepath.Ext(src)
+	if ext == "" || !IsRAWExt(ext) {
+		return ErrUnsupportedWatermarkType
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var out *os.File
+	err = w.markRAW(in, FileMeta{Path: src, Ext: strings.ToLower(ext)}, point, func() (io.Writer, error) {
+		var err error
+		out, err = os.Create(dst)
+		return out, err
+	})
+	if out == nil {
+		return err
+	}
+
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// MarkRAW 提取 RAW 文件内嵌的预览图，打上水印后以 JPEG 格式写入 dst。
+//
+// 支持 CR2、NEF、ARW 等基于 TIFF 结构的格式，
+// 若存在多张预览图，则取可解码的尺寸最大的一张，超过 Options.MaxPixels 的预览图会被忽略。
+func (w *Watermark) MarkRAW(src io.ReadSeeker, dst io.Writer, point image.Point) error {
+	return w.markRAW(src, FileMeta{}, point, func() (io.Writer, error) {
+		return dst, nil
+	})
+}
+
+// meta 为传递给 Options.Metadata 的 RAW 文件信息，dst 的含义与 markTo 相同，其它参数与 MarkRAW 相同。
+func (w *Watermark) markRAW(src io.ReadSeeker, meta FileMeta, point image.Point, dst func() (io.Writer, error)) error {
+	markImg, err := w.load()
+	if err != nil {
+		return err
+	}
+
+	img, err := rawPreview(src, w.maxPixels())
+	if err != nil {
+		return err
+	}
+
+	// 与 markTo 相同，未达到尺寸要求的预览图不打水印，直接输出。
+	if size := img.Bounds().Size(); size.X < w.options.MinWidth || size.Y < w.options.MinHeight {
+		out, err := dst()
+		if err != nil {
+			return err
+		}
+		return w.encode(out, img, ".jpg", meta)
+	}
+
+	point, _ = w.place(point, img.Bounds(), markImg.Bounds())
+	dstImg, release, err := w.draw(img, markImg, point)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	out, err := dst()
+	if err != nil {
+		return err
+	}
+	return w.encode(out, dstImg, ".jpg", meta)
+}
+
+// RAWPreview 返回 RAW 文件中内嵌的最大的 JPEG 预览图
+//
+// 超过 DefaultMaxPixels 的预览图会被忽略。
+func RAWPreview(r io.ReadSeeker) (image.Image, error) {
+	return rawPreview(r, DefaultMaxPixels)
+}
+
+// 与 RAWPreview 相同，但忽略的是像素数超过 limit 的预览图。
+func rawPreview(r io.Reader, limit int64) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	previews, err := rawPreviews(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// 全尺寸的原始数据在部分格式中同样以 JPEG 标记开头（无损 JPEG），
+	// 标准库无法解码，所以按大小依次尝试，直到解码成功。
+	sort.Slice(previews, func(i, j int) bool { return len(previews[i]) > len(previews[j]) })
+	for _, p := range previews {
+		conf, err := decodeConfig(bytes.NewReader(p), ".jpg")
+		if err != nil || conf.Width <= 0 || conf.Height <= 0 || int64(conf.Width)*int64(conf.Height) > limit {
+			continue
+		}
+		if img, err := decode(bytes.NewReader(p), ".jpg"); err == nil {
+			return img, nil
+		}
+	}
+	return nil, ErrNoRAWPreview
+}
+
+// 遍历 TIFF 结构中的所有 IFD，返回所有以 JPEG SOI 标记开头的数据块。
+func rawPreviews(data []byte) ([][]byte, error) {
+	if len(data) < 8 {
+		return nil, ErrNoRAWPreview
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, ErrUnsupportedWatermarkType
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, ErrUnsupportedWatermarkType
+	}
+
+	var previews [][]byte
+	add := func(offset, length uint32) {
+		end := uint64(offset) + uint64(length)
+		if length < 2 || end > uint64(len(data)) {
+			return
+		}
+		if p := data[offset:end]; p[0] == 0xff && p[1] == 0xd8 {
+			previews = append(previews, p)
+		}
+	}
+
+	// 待读取和已读取的 IFD 总数不超过 maxIFDs，以免构造的 SubIFDs 数量导致大量分配。
+	queue := []uint32{order.Uint32(data[4:])}
+	visited := make(map[uint32]bool, maxIFDs)
+	push := func(offset uint32) bool {
+		if len(queue)+len(visited) >= maxIFDs {
+			return false
+		}
+		queue = append(queue, offset)
+		return true
+	}
+	for len(queue) > 0 && len(visited) < maxIFDs {
+		offset := queue[0]
+		queue = queue[1:]
+		if offset == 0 || visited[offset] || uint64(offset)+2 > uint64(len(data)) {
+			continue
+		}
+		visited[offset] = true
+
+		count := uint64(order.Uint16(data[offset:]))
+		entries := uint64(offset) + 2
+		if entries+count*12+4 > uint64(len(data)) {
+			continue
+		}
+
+		var jpegOffset, jpegLength, stripOffset, stripLength uint32
+		var compression uint32
+		for i := uint64(0); i < count; i++ {
+			e := data[entries+i*12:]
+			tag, typ := order.Uint16(e), order.Uint16(e[2:])
+			n := order.Uint32(e[4:])
+			val := order.Uint32(e[8:])
+			if typ == 3 { // SHORT
+				val = uint32(order.Uint16(e[8:]))
+			}
+
+			switch tag {
+			case tagCompression:
+				compression = val
+			case tagJPEGOffset:
+				jpegOffset = val
+			case tagJPEGLength:
+				jpegLength = val
+			case tagStripOffsets:
+				if n == 1 {
+					stripOffset = val
+				}
+			case tagStripByteCounts:
+				if n == 1 {
+					stripLength = val
+				}
+			case tagExifIFD:
+				push(val)
+			case tagSubIFDs:
+				if n == 1 {
+					push(val)
+					break
+				}
+				if n > maxIFDs {
+					n = maxIFDs
+				}
+				for j := uint64(0); j < uint64(n); j++ {
+					p := uint64(val) + j*4
+					if p+4 > uint64(len(data)) || !push(order.Uint32(data[p:])) {
+						break
+					}
+				}
+			}
+		}
+
+		add(jpegOffset, jpegLength)
+		if compression == 6 || compression == 7 {
+			add(stripOffset, stripLength)
+		}
+
+		push(order.Uint32(data[entries+count*12:]))
+	}
+
+	if len(previews) == 0 {
+		return nil, ErrNoRAWPreview
+	}
+	return previews, nil
+}
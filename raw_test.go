@@ -0,0 +1,79 @@
+package watermark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"testing"
+)
+
+// 返回以 preview 作为 JPEG 预览图的最简 TIFF 数据
+func testRAW(preview []byte) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("II*\x00")
+	binary.Write(buf, binary.LittleEndian, uint32(8))
+
+	// IFD：两个条目，之后是下一个 IFD 的偏移量
+	const ifdSize = 2 + 2*12 + 4
+	binary.Write(buf, binary.LittleEndian, uint16(2))
+	for _, e := range [][2]uint32{
+		{tagJPEGOffset, 8 + ifdSize},
+		{tagJPEGLength, uint32(len(preview))},
+	} {
+		binary.Write(buf, binary.LittleEndian, uint16(e[0]))
+		binary.Write(buf, binary.LittleEndian, uint16(4)) // LONG
+		binary.Write(buf, binary.LittleEndian, uint32(1))
+		binary.Write(buf, binary.LittleEndian, e[1])
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+
+	buf.Write(preview)
+	return buf.Bytes()
+}
+
+func TestRAWPreview(t *testing.T) {
+	img, err := RAWPreview(bytes.NewReader(testRAW(testImage(t, ".jpg", 32, 16))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != 32 || size.Y != 16 {
+		t.Errorf("预览图尺寸为 %v", size)
+	}
+}
+
+func TestRAWPreviewSubIFDs(t *testing.T) {
+	// maxIFDs 个首尾相连的 IFD，每个都声明了 0xffffffff 个 SubIFDs，指向全零的数据。
+	const ifdSize = 2 + 12 + 4
+	data := make([]byte, 8+maxIFDs*ifdSize+1<<20)
+	copy(data, "II*\x00")
+	binary.LittleEndian.PutUint32(data[4:], 8)
+	for i := 0; i < maxIFDs; i++ {
+		e := data[8+i*ifdSize:]
+		binary.LittleEndian.PutUint16(e, 1)
+		binary.LittleEndian.PutUint16(e[2:], tagSubIFDs)
+		binary.LittleEndian.PutUint16(e[4:], 4) // LONG
+		binary.LittleEndian.PutUint32(e[6:], 0xffffffff)
+		binary.LittleEndian.PutUint32(e[10:], 8+maxIFDs*ifdSize)
+		binary.LittleEndian.PutUint32(e[14:], uint32(8+(i+1)*ifdSize))
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := rawPreviews(data); err != ErrNoRAWPreview {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("分配了 %d 字节", n)
+	}
+}
+
+// FuzzRAWPreview 检测任意的输入数据都不会导致 panic
+func FuzzRAWPreview(f *testing.F) {
+	f.Add(testRAW(testImage(f, ".jpg", 16, 16)))
+	f.Add([]byte("MM\x00*\x00\x00\x00\x08"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		rawPreview(bytes.NewReader(data), 1<<20)
+	})
+}
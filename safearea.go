@@ -0,0 +1,52 @@
+package watermark
+
+import "image"
+
+// SafeArea 目标图片四周会被平台界面遮挡的区域，以占宽或高的百分比表示。
+type SafeArea struct {
+	Top, Right, Bottom, Left float64
+}
+
+// 内置的各平台安全区域
+//
+// 数值参考各平台公开的设计规范，取偏保守的近似值。
+var safeAreas = map[string]SafeArea{
+	"instagram-story":   {Top: 14, Bottom: 20},
+	"instagram-reel":    {Top: 10, Right: 15, Bottom: 35},
+	"tiktok":            {Top: 10, Right: 15, Bottom: 25},
+	"youtube-shorts":    {Top: 10, Right: 15, Bottom: 30},
+	"youtube-thumbnail": {Right: 15, Bottom: 15},
+}
+
+// SafeAreaByName 返回名为 name 的内置安全区域
+//
+// 可用的名称有 instagram-story、instagram-reel、tiktok、youtube-shorts 和 youtube-thumbnail，
+// 不存在时 found 返回 false。
+func SafeAreaByName(name string) (a SafeArea, found bool) {
+	a, found = safeAreas[name]
+	return a, found
+}
+
+// Rect 返回 r 去除遮挡区域之后剩余的范围
+func (a SafeArea) Rect(r image.Rectangle) image.Rectangle {
+	w, h := float64(r.Dx()), float64(r.Dy())
+	return image.Rect(
+		r.Min.X+int(w*a.Left/100),
+		r.Min.Y+int(h*a.Top/100),
+		r.Max.X-int(w*a.Right/100),
+		r.Max.Y-int(h*a.Bottom/100),
+	)
+}
+
+// Apply 返回只在安全区域内计算水印位置的 PositionFunc
+//
+// pos 收到的 srcBounds 为去除遮挡区域之后的范围，
+// 比如：
+//
+//	a, _ := SafeAreaByName("instagram-story")
+//	pos := a.Apply(Anchor(BottomRight, 10))
+func (a SafeArea) Apply(pos PositionFunc) PositionFunc {
+	return func(srcBounds, markBounds image.Rectangle, meta FileMeta) image.Point {
+		return pos(a.Rect(srcBounds), markBounds, meta)
+	}
+}
@@ -0,0 +1,37 @@
+package watermark
+
+import (
+	"fmt"
+	"image"
+	"os"
+)
+
+// MarkSequence 给编号连续的帧序列打上水印
+//
+// pattern 为 fmt 格式的文件路径，比如 frames/frame_%06d.png，
+// 从编号 start 开始依次处理，直到对应的文件不存在为止，返回处理的帧数。
+//
+// 水印位置仅根据第一帧计算，之后的所有帧都使用相同的位置，
+// 以保证合成视频时水印不会跳动。配合 Options.Reuse 可以减少每帧的内存分配。
+func (w *Watermark) MarkSequence(pattern string, start int, pos PositionFunc) (n int, err error) {
+	var p *image.Point
+	fixed := func(srcBounds, markBounds image.Rectangle, meta FileMeta) image.Point {
+		if p == nil {
+			pt := pos(srcBounds, markBounds, meta)
+			p = &pt
+		}
+		return *p
+	}
+
+	for i := start; ; i++ {
+		path := fmt.Sprintf(pattern, i)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return n, nil
+		}
+
+		if err := w.MarkFileFunc(path, fixed); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
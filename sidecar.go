@@ -0,0 +1,83 @@
+package watermark
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"image"
+	"io"
+	"os"
+)
+
+// Sidecar 输出文件所应用的水印参数
+//
+// 当 Options.Sidecar 为 true 时，会以 JSON 格式保存在输出文件旁边的 .wm.json 文件中，
+// 比如 photo.jpg 对应 photo.jpg.wm.json。
+type Sidecar struct {
+	Source     string `json:"source"`     // 源文件
+	Output     string `json:"output"`     // 输出文件
+	Watermark  string `json:"watermark"`  // 水印文件
+	X          int    `json:"x"`          // 水印左上角的横坐标
+	Y          int    `json:"y"`          // 水印左上角的纵坐标
+	Width      int    `json:"width"`      // 水印的宽度，因尺寸过小而未打水印时为 0
+	Height     int    `json:"height"`     // 水印的高度
+	ConfigHash string `json:"configHash"` // 水印图片内容和所有选项的 sha256 值
+	OutputHash string `json:"outputHash"` // 输出文件内容的校验值，算法由 Options.Hash 决定
+}
+
+// SidecarPath 返回输出文件 output 对应的 .wm.json 文件路径
+//
+// 保留了 output 的扩展名，以免 photo.jpg 和 photo.png 等同名文件共用同一个 .wm.json 文件。
+func SidecarPath(output string) string {
+	return output + ".wm.json"
+}
+
+// 若启用了 Options.Sidecar，返回用于计算输出文件校验值的 hash.Hash，否则返回 nil。
+func (w *Watermark) outputHash() hash.Hash {
+	if !w.options.Sidecar {
+		return nil
+	}
+
+	if w.options.Hash != nil {
+		return w.options.Hash()
+	}
+	return sha256.New()
+}
+
+// 返回同时写入 w 和 h 的 io.Writer，h 为 nil 时直接返回 w。
+func hashWriter(w io.Writer, h hash.Hash) io.Writer {
+	if h == nil {
+		return w
+	}
+	return io.MultiWriter(w, h)
+}
+
+// 若启用了 Options.Sidecar，则将 r 和输出文件的校验值 h 写入 output 对应的 .wm.json 文件。
+func (w *Watermark) writeSidecar(src, output string, r image.Rectangle, h hash.Hash) error {
+	if !w.options.Sidecar {
+		return nil
+	}
+
+	config, err := w.configHash()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(&Sidecar{
+		Source:     src,
+		Output:     output,
+		Watermark:  w.path,
+		X:          r.Min.X,
+		Y:          r.Min.Y,
+		Width:      r.Dx(),
+		Height:     r.Dy(),
+		ConfigHash: config,
+		OutputHash: hex.EncodeToString(h.Sum(nil)),
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(SidecarPath(output), data, 0666)
+}
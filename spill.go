@@ -0,0 +1,75 @@
+package watermark
+
+import (
+	"image"
+	"image/draw"
+)
+
+// 分配合成所用的像素缓冲区
+//
+// 不透明的图片使用编解码器和 draw 包都有优化的 *image.RGBA；含有透明像素的图片使用 *image.NRGBA，
+// 以免预乘透明度时丢失半透明像素的颜色；16 位的图片使用 *image.NRGBA64，以免丢失精度。
+//
+// 当缓冲区大小超过 Options.SpillSize 时，优先使用临时文件映射的内存，
+// 以免在内存受限的环境中处理超大图片时被强制终止；
+// 否则在 Options.Reuse 为 true 时从 buffers 中取可复用的内存。
+func (w *Watermark) newBuffer(src image.Image) (img draw.Image, release func(), err error) {
+	r := src.Bounds()
+	deep := isDeep(src)
+	bpp := 4
+	if deep {
+		bpp = 8
+	}
+	size := int64(r.Dx()) * int64(r.Dy()) * int64(bpp)
+
+	var pix []byte
+	switch {
+	case w.options.SpillSize > 0 && size > w.options.SpillSize:
+		if pix, release, err = mapBuffer(w.options.SpillDir, int(size)); err != nil {
+			return nil, nil, err
+		}
+	case w.options.Reuse:
+		pix, release = w.reuseBuffer(int(size))
+	default:
+		pix, release = make([]byte, size), func() {}
+	}
+
+	switch {
+	case deep:
+		return &image.NRGBA64{Pix: pix, Stride: bpp * r.Dx(), Rect: r}, release, nil
+	case isOpaque(src):
+		return &image.RGBA{Pix: pix, Stride: bpp * r.Dx(), Rect: r}, release, nil
+	default:
+		return &image.NRGBA{Pix: pix, Stride: bpp * r.Dx(), Rect: r}, release, nil
+	}
+}
+
+// 是否为每个分量 16 位的图片
+func isDeep(img image.Image) bool {
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return true
+	default:
+		return false
+	}
+}
+
+// 是否为完全不透明的图片，无法判断时返回 false。
+func isOpaque(img image.Image) bool {
+	o, ok := img.(interface{ Opaque() bool })
+	return ok && o.Opaque()
+}
+
+// 从 buffers 中获取至少 size 字节的内存，容量不足时重新分配。
+//
+// 返回的内存可能包含之前的内容，调用方需要完整覆盖。
+func (w *Watermark) reuseBuffer(size int) (buf []byte, release func()) {
+	p, _ := w.buffers.Get().(*[]byte)
+	if p == nil || cap(*p) < size {
+		b := make([]byte, size)
+		p = &b
+	}
+	buf = (*p)[:size]
+
+	return buf, func() { w.buffers.Put(p) }
+}
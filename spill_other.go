@@ -0,0 +1,8 @@
+//go:build !unix
+
+package watermark
+
+// 不支持 mmap 的系统直接从内存中分配
+func mapBuffer(dir string, size int) (buf []byte, release func(), err error) {
+	return make([]byte, size), func() {}, nil
+}
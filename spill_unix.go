@@ -0,0 +1,31 @@
+//go:build unix
+
+package watermark
+
+import (
+	"os"
+	"syscall"
+)
+
+// 返回由临时文件映射的 size 字节内存
+//
+// 临时文件在映射之后即被删除，调用 release 解除映射后由系统回收。
+func mapBuffer(dir string, size int) (buf []byte, release func(), err error) {
+	f, err := os.CreateTemp(dir, "watermark-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	if err = f.Truncate(int64(size)); err != nil {
+		return nil, nil, err
+	}
+
+	buf, err = syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return buf, func() { syscall.Munmap(buf) }, nil
+}
@@ -1,32 +1,192 @@
 // Package watermark 提供一个简单的水印功能。
+//
+// 当前版本的导入路径为 github.com/hard88/watermark/v2，
+// New、Mark、MarkFile 和 IsAllowExt 保持了 v1 的函数签名，新增的功能均通过 Options 启用。
+// 使用默认选项时，与 v1 的行为有以下不同：
+//   - 超过 DefaultMaxPixels 像素的目标图片会返回 ErrImageTooLarge，而 v1 不作限制，
+//     可将 Options.MaxPixels 设置为 math.MaxInt64 以恢复 v1 的行为；
+//   - 宽或高不是正数的图片返回 ErrInvalidImageSize，解码器内部的 panic 转换为错误返回；
+//   - 8 位的 PNG 图片输出为 8 位，而不是 v1 的 16 位。水印范围之外的像素保持原值，
+//     水印所覆盖的半透明像素以 8 位精度保存合成结果，与 v1 相比会有舍入误差；
+//   - MarkFile 会截断新内容之后多余的部分，不再残留原文件末尾的数据。
 package watermark
 
 import (
 	"errors"
+	"fmt"
+	"hash"
 	"image"
 	"image/draw"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // ErrUnsupportedWatermarkType 不支持的水印类型
 var ErrUnsupportedWatermarkType = errors.New("不支持的水印类型")
 
+// ErrInvalidOptions Options 中存在无效的值
+var ErrInvalidOptions = errors.New("无效的选项")
+
 // 允许做水印的图片类型
 var allowExts = []string{
 	".jpg", ".jpeg", ".png",
 }
 
+// Options 声明 Watermark 对象时的可选项
+type Options struct {
+	// Lenient 是否容忍被截断的 JPEG 图片
+	//
+	// 为 true 时，会解码截断前的内容，缺失部分以无意义的像素填充，
+	// 然后照常打上水印；否则直接返回解码错误。
+	// 仅适用于基线（非渐进式）JPEG 在文件末尾被截断的情况，其它解码错误照常返回。
+	Lenient bool
+
+	// SpillSize 合成所用的像素缓冲区超过该字节数时，改由临时文件提供存储
+	//
+	// 缓冲区按每像素 4 字节计算，16 位的图片按 8 字节计算，0 表示始终使用内存。
+	// 仅在支持 mmap 的系统上有效，其它系统上会忽略该值。
+	SpillSize int64
+
+	// SpillDir 存放临时文件的目录，为空时使用 os.TempDir()。
+	SpillDir string
+
+	// Reuse 是否复用合成所用的像素缓冲区
+	//
+	// 为 true 时，同一 Watermark 对象在多次调用之间会复用已分配的缓冲区，
+	// 除编解码器自身的分配外，处理尺寸不超过之前的图片时不再分配像素内存。
+	Reuse bool
+
+	// Lazy 是否延迟加载水印图片
+	//
+	// 为 true 时，New 仅检测文件是否存在，直到第一次使用时才解码水印图片。
+	Lazy bool
+
+	// Collision MarkFileTo 的目标文件已经存在时的处理方式，默认为覆盖。
+	Collision Collision
+
+	// Format 输出图片的格式，以扩展名表示，比如 .jpg、.png、.gif
+	//
+	// 仅对 MarkFileTo 和 MarkMIME 等输出到新位置的操作有效，
+	// 为空时与源图片格式相同；原地修改的 Mark 和 MarkFile 始终保持源图片的格式。
+	Format string
+
+	// Quality 输出 JPEG 图片时的质量，取值 1-100，0 表示使用默认值。
+	Quality int
+
+	// MaxPixels 允许解码的目标图片的最大像素数，超过时返回 ErrImageTooLarge
+	//
+	// 0 表示使用 DefaultMaxPixels。v1 没有该限制，设置为 math.MaxInt64 可以取消限制。
+	MaxPixels int64
+
+	// Encode 传递给各个编码器的参数
+	Encode EncodeOptions
+
+	// MinContrast 水印与其下方区域之间的最小对比度，取值 1-21，0 表示不检测
+	//
+	// 对比度按 WCAG 的定义计算，若低于该值，则会在水印下方添加半透明的黑色或白色背景，
+	// 背景的不透明度在 sRGB 编码空间中求解，取满足该对比度所需的最小值；
+	// 背景不均匀时，绘制之后会重新测量，不足时再补上一层，因此可能略高于该值。
+	MinContrast float64
+
+	// Sidecar 是否在每个输出文件旁边写入记录了水印参数的 .wm.json 文件
+	//
+	// 仅对 MarkFile、MarkFileFunc 和 MarkFileTo 等输出到文件的操作有效，具体内容参考 Sidecar 类型。
+	Sidecar bool
+
+	// Hash 用于计算 Sidecar 中输出文件校验值的算法，为空时使用 sha256.New。
+	Hash func() hash.Hash
+
+	// MinWidth 和 MinHeight 目标图片的最小尺寸
+	//
+	// 宽或高小于该值的图片不会打上水印，比如缩略图和图标，
+	// 输出到新位置时会原样复制，若指定了 Options.Format，则只转换格式；
+	// 对于 RAW 文件，以预览图的尺寸为准，未打水印的预览图同样以 JPEG 格式输出。
+	MinWidth, MinHeight int
+
+	// NoBleed 是否保证水印完全位于目标图片之内
+	//
+	// 为 true 时，超出目标图片边缘的水印会被移回图片之内；
+	// 若水印比目标图片还大，则与图片的左上角对齐。
+	NoBleed bool
+
+	// Floor 在整个目标图片上平铺的淡化水印的不透明度，取值 0-1，0 表示不平铺
+	//
+	// 平铺的水印叠加在可见水印的下方，通常取 0.02-0.05 之类肉眼难以察觉的值，
+	// 用于增加通过简单的图像修复去除水印的难度。
+	Floor float64
+
+	// FloorAdaptive 是否根据各处背景的亮度，分别为平铺的每一块水印选择原色或反色
+	//
+	// 使平铺的水印在明暗交错的图片上都能保持可辨认，仅在 Floor 大于 0 时有效。
+	FloorAdaptive bool
+
+	// Metadata 返回需要写入各个输出图片的元数据，比如订单号和授权信息
+	//
+	// 在编码时直接写入，无需再次改写输出文件。PNG 写入 tEXt 块，JPEG 写入 key=value 形式的 COM 段，
+	// 其它格式忽略；meta 为目标图片的相关信息，返回 nil 表示不写入元数据。
+	Metadata func(meta FileMeta) map[string]string
+}
+
+// Validate 检测各个选项的值是否有效
+//
+// 返回的错误均包装了 ErrInvalidOptions。NewWithOptions 和 NewFromImage 会自动调用，
+// 以免无效的值直到写入输出文件时才被发现。
+func (o *Options) Validate() error {
+	switch {
+	case o.SpillSize < 0:
+		return fmt.Errorf("%w：SpillSize 不能为负数", ErrInvalidOptions)
+	case o.Collision < Overwrite || o.Collision > Rename:
+		return fmt.Errorf("%w：Collision 的值 %d 无效", ErrInvalidOptions, o.Collision)
+	case o.Format != "" && !isOutputExt(strings.ToLower(o.Format)):
+		return fmt.Errorf("%w：不支持的输出格式 %q", ErrInvalidOptions, o.Format)
+	case o.Quality < 0 || o.Quality > 100:
+		return fmt.Errorf("%w：Quality 的取值范围为 1-100", ErrInvalidOptions)
+	case o.MaxPixels < 0:
+		return fmt.Errorf("%w：MaxPixels 不能为负数", ErrInvalidOptions)
+	case o.MinContrast != 0 && !(o.MinContrast >= 1 && o.MinContrast <= 21):
+		return fmt.Errorf("%w：MinContrast 的取值范围为 1-21", ErrInvalidOptions)
+	case o.MinWidth < 0 || o.MinHeight < 0:
+		return fmt.Errorf("%w：MinWidth 和 MinHeight 不能为负数", ErrInvalidOptions)
+	case !(o.Floor >= 0 && o.Floor <= 1):
+		return fmt.Errorf("%w：Floor 的取值范围为 0-1", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// 是否为可以作为输出格式的扩展名，ext 必须为小写。
+func isOutputExt(ext string) bool {
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	default:
+		return false
+	}
+}
+
+// EncodeOptions 传递给各个编码器的参数，为 nil 的字段表示使用编码器的默认值。
+type EncodeOptions struct {
+	JPEG *jpeg.Options // 若不为 nil，则忽略 Options.Quality
+	PNG  *png.Encoder
+	GIF  *gif.Options
+}
 
 // Watermark 用于给图片添加水印功能。
 // 目前支持  png 三种图片格式。
 // 若是 gif 图片，则只取图片的第一帧；png 支持透明背景。
 type Watermark struct {
-	image   image.Image // 水印图片
+	path    string // 水印文件的路径，由 NewFromImage 声明时为空
+	options Options
+	buffers sync.Pool // 可复用的像素缓冲区，仅在 Options.Reuse 为 true 时使用
+
+	mu    sync.Mutex
+	image image.Image // 水印图片，未加载或是已经释放时为 nil
+	sum   string      // 缓存的 assetHash 结果
 }
 
 // New 声明一个 Watermark 对象。
@@ -35,28 +195,97 @@ type Watermark struct {
 // padding 为水印在目标图像上的留白大小；
 // pos 水印的位置。
 func New(path string) (*Watermark, error) {
-	f, err := os.Open(path)
-	if err != nil {
+	return NewWithOptions(path, nil)
+}
+
+// NewWithOptions 声明一个 Watermark 对象，opt 为 nil 时等同于 New。
+//
+// opt 中存在无效的值时，返回 Options.Validate 的错误。
+func NewWithOptions(path string, opt *Options) (*Watermark, error) {
+	if opt == nil {
+		opt = &Options{}
+	}
+	if err := opt.Validate(); err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	var img image.Image
-	switch strings.ToLower(filepath.Ext(path)) {
-	case ".jpg", ".jpeg":
-		img, err = jpeg.Decode(f)
-	case ".png":
-		img, err = png.Decode(f)
-	default:
-		return nil, ErrUnsupportedWatermarkType
+	w := &Watermark{
+		path:    path,
+		options: *opt,
 	}
-	if err != nil {
+
+	if opt.Lazy {
+		// 与立即加载时返回相同的错误，没有扩展名时不能交给 IsAllowExt，否则会 panic。
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		if ext := filepath.Ext(path); ext == "" || !IsAllowExt(ext) {
+			return nil, ErrUnsupportedWatermarkType
+		}
+		return w, nil
+	}
+
+	if _, err := w.load(); err != nil {
 		return nil, err
 	}
+	return w, nil
+}
+
+// NewFromImage 以 img 作为水印图片声明一个 Watermark 对象，opt 为 nil 时使用默认选项。
+//
+// 适用于在程序中生成的水印，比如 Code128 等函数生成的条形码。
+// 此时 Options.Lazy 无效，Close 也不会释放 img。opt 中存在无效的值时会 panic。
+func NewFromImage(img image.Image, opt *Options) *Watermark {
+	if opt == nil {
+		opt = &Options{}
+	}
+	if err := opt.Validate(); err != nil {
+		panic(err)
+	}
 
 	return &Watermark{
+		options: *opt,
 		image:   img,
-	}, nil
+	}
+}
+
+// Close 释放水印图片所占用的内存
+//
+// 之后再次使用该对象时，会重新从文件中加载水印图片。
+// 由 NewFromImage 声明的对象没有对应的文件，调用 Close 不会有任何效果。
+func (w *Watermark) Close() error {
+	if w.path == "" {
+		return nil
+	}
+
+	w.mu.Lock()
+	w.image = nil
+	w.mu.Unlock()
+	return nil
+}
+
+// 返回水印图片，若尚未加载，则从文件中加载。
+func (w *Watermark) load() (image.Image, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.image != nil {
+		return w.image, nil
+	}
+
+	f, err := os.Open(w.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := decode(f, strings.ToLower(filepath.Ext(w.path)))
+	if err != nil {
+		return nil, err
+	}
+
+	w.image = img
+	return img, nil
 }
 
 // IsAllowExt 该扩展名的图片是否允许使用水印
@@ -83,45 +312,221 @@ func IsAllowExt(ext string) bool {
 
 // MarkFile 给指定的文件打上水印
 func (w *Watermark) MarkFile(path string, point image.Point) error {
+	return w.markFile(path, func(_, _ image.Rectangle, _ FileMeta) image.Point {
+		return point
+	})
+}
+
+// 给指定的文件打上水印，point 返回传递给 draw 的水印起点，而不是水印左上角的坐标。
+func (w *Watermark) markFile(path string, point func(srcBounds, markBounds image.Rectangle, meta FileMeta) image.Point) error {
 	file, err := os.OpenFile(path, os.O_RDWR, os.ModePerm)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	return w.Mark(file, strings.ToLower(filepath.Ext(path)), point)
+	var r image.Rectangle
+	h := w.outputHash()
+	meta := FileMeta{Path: path, Ext: strings.ToLower(filepath.Ext(path))}
+	err = w.markTo(file, meta, func(srcBounds, markBounds image.Rectangle) image.Point {
+		return point(srcBounds, markBounds, meta)
+	}, &r, meta.Ext, func() (io.Writer, error) {
+		if _, err := file.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		return hashWriter(file, h), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 新内容可能比原文件短，需要截断多余的部分，否则校验值会与文件内容不符。
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if err = file.Truncate(size); err != nil {
+		return err
+	}
+
+	return w.writeSidecar(path, path, r, h)
 }
 
 // Mark 将水印写入 src 中，由 ext 确定当前图片的类型。
 func (w *Watermark) Mark(src io.ReadWriteSeeker, ext string, point image.Point) (err error) {
-	var srcImg image.Image
+	return w.mark(src, FileMeta{Ext: strings.ToLower(ext)}, func(_, _ image.Rectangle) image.Point {
+		return point
+	})
+}
 
-	ext = strings.ToLower(ext)
-	switch ext {
-	case ".jpg", ".jpeg":
-		srcImg, err = jpeg.Decode(src)
-	case ".png":
-		srcImg, err = png.Decode(src)
-	default:
-		return ErrUnsupportedWatermarkType
+// 将水印写入 src 中，point 根据解码后的图片范围和水印范围返回传递给 draw 的水印起点。
+func (w *Watermark) mark(src io.ReadWriteSeeker, meta FileMeta, point func(srcBounds, markBounds image.Rectangle) image.Point) error {
+	return w.markTo(src, meta, point, nil, meta.Ext, func() (io.Writer, error) {
+		_, err := src.Seek(0, 0)
+		return src, err
+	})
+}
+
+// 解码 src 并打上水印，之后以 outExt 指定的格式将结果写入 dst 返回的对象中。
+//
+// 若 placed 不为 nil，则会将水印在目标图片中的实际范围写入其中。
+// dst 仅在合成成功之后才会被调用，这样在出错时不会产生空的输出文件。
+func (w *Watermark) markTo(src io.Reader, meta FileMeta, point func(srcBounds, markBounds image.Rectangle) image.Point, placed *image.Rectangle, outExt string, dst func() (io.Writer, error)) error {
+	markImg, err := w.load()
+	if err != nil {
+		return err
+	}
+
+	ext := meta.Ext
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	conf, err := w.decodeConfig(data, ext)
+	if err != nil {
+		return err
+	}
+	if conf.Width < w.options.MinWidth || conf.Height < w.options.MinHeight {
+		return w.passThrough(data, meta, outExt, dst)
+	}
+
+	srcImg, err := w.decode(data, ext)
+	if err != nil {
+		return err
+	}
+
+	sp, r := w.place(point(srcImg.Bounds(), markImg.Bounds()), srcImg.Bounds(), markImg.Bounds())
+	if placed != nil {
+		*placed = r
+	}
+
+	dstImg, release, err := w.draw(srcImg, markImg, sp)
+	if err != nil {
+		return err
 	}
+	defer release()
+
+	out, err := dst()
 	if err != nil {
 		return err
 	}
 
-	dstImg := image.NewNRGBA64(srcImg.Bounds())
-	draw.Draw(dstImg, dstImg.Bounds(), srcImg, image.ZP, draw.Src)
-	draw.Draw(dstImg, dstImg.Bounds(), w.image, point, draw.Over)
+	return w.encode(out, dstImg, outExt, meta)
+}
+
+// 根据传递给 draw 的水印起点 sp 计算水印在目标图片中的范围
+//
+// 若启用了 Options.NoBleed，则会调整水印位置，使其完全位于目标图片之内，
+// 返回值为调整之后的水印起点及其范围。
+func (w *Watermark) place(sp image.Point, srcBounds, markBounds image.Rectangle) (image.Point, image.Rectangle) {
+	at := srcBounds.Min.Add(markBounds.Min).Sub(sp)
+
+	if w.options.NoBleed {
+		end := srcBounds.Max.Sub(markBounds.Size())
+		at.X = clamp(at.X, srcBounds.Min.X, end.X)
+		at.Y = clamp(at.Y, srcBounds.Min.Y, end.Y)
+		sp = srcBounds.Min.Add(markBounds.Min).Sub(at)
+	}
+
+	return sp, image.Rectangle{Min: at, Max: at.Add(markBounds.Size())}
+}
 
-	if _, err = src.Seek(0, 0); err != nil {
+// 将 v 限制在 [lo, hi] 之间，当 hi < lo 时以 lo 为准。
+func clamp(v, lo, hi int) int {
+	if v > hi {
+		v = hi
+	}
+	if v < lo {
+		v = lo
+	}
+	return v
+}
+
+// 将未达到尺寸要求的图片原样写入 dst，若输出格式不同，则只转换格式而不打水印。
+func (w *Watermark) passThrough(data []byte, meta FileMeta, outExt string, dst func() (io.Writer, error)) error {
+	ext := meta.Ext
+	if sameFormat(ext, outExt) {
+		out, err := dst()
+		if err != nil {
+			return err
+		}
+		return w.writeMetadata(out, meta, outExt, func(out io.Writer) error {
+			_, err := out.Write(data)
+			return err
+		})
+	}
+
+	img, err := w.decode(data, ext)
+	if err != nil {
+		return err
+	}
+	out, err := dst()
+	if err != nil {
 		return err
 	}
+	return w.encode(out, img, outExt, meta)
+}
+
+// 两个扩展名是否表示相同的图片格式，ext1 和 ext2 必须为小写。
+func sameFormat(ext1, ext2 string) bool {
+	if ext1 == ".jpeg" {
+		ext1 = ".jpg"
+	}
+	if ext2 == ".jpeg" {
+		ext2 = ".jpg"
+	}
+	return ext1 == ext2
+}
 
+// 将水印绘制到 srcImg 的副本上，使用完之后需要调用 release 释放缓冲区。
+func (w *Watermark) draw(srcImg, markImg image.Image, point image.Point) (dstImg draw.Image, release func(), err error) {
+	buf, release, err := w.newBuffer(srcImg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	draw.Draw(buf, buf.Bounds(), srcImg, image.ZP, draw.Src)
+	if w.options.Floor > 0 {
+		w.drawFloor(buf, markImg)
+	}
+	if w.options.MinContrast > 0 {
+		w.ensureContrast(buf, markImg, point)
+	}
+	drawOver(buf, markImg, point)
+	return buf, release, nil
+}
+
+// 输出到新位置时所使用的格式，srcExt 为源图片的扩展名。
+func (w *Watermark) outputExt(srcExt string) string {
+	if w.options.Format == "" {
+		return srcExt
+	}
+	return strings.ToLower(w.options.Format)
+}
+
+// 根据扩展名 ext 编码图片，ext 必须为小写，meta 为传递给 Options.Metadata 的目标图片信息。
+func (w *Watermark) encode(dst io.Writer, img image.Image, ext string, meta FileMeta) error {
+	return w.writeMetadata(dst, meta, ext, func(dst io.Writer) error {
+		return w.encodeImage(dst, img, ext)
+	})
+}
+
+// 根据扩展名 ext 编码图片，不写入元数据。
+func (w *Watermark) encodeImage(dst io.Writer, img image.Image, ext string) error {
 	switch ext {
 	case ".jpg", ".jpeg":
-		return jpeg.Encode(src, dstImg, nil)
+		o := w.options.Encode.JPEG
+		if o == nil && w.options.Quality > 0 {
+			o = &jpeg.Options{Quality: w.options.Quality}
+		}
+		return jpeg.Encode(dst, img, o)
 	case ".png":
-		return png.Encode(src, dstImg)
+		if e := w.options.Encode.PNG; e != nil {
+			return e.Encode(dst, img)
+		}
+		return png.Encode(dst, img)
+	case ".gif":
+		return gif.Encode(dst, img, w.options.Encode.GIF)
 	default:
 		return ErrUnsupportedWatermarkType
 	}
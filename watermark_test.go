@@ -0,0 +1,104 @@
+package watermark
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 返回指定格式和尺寸的测试图片，内容为渐变色。
+func testImage(tb testing.TB, ext string, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 255})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	var err error
+	switch ext {
+	case ".jpg":
+		err = jpeg.Encode(buf, img, nil)
+	case ".png":
+		err = png.Encode(buf, img)
+	}
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 返回半透明的测试水印
+func testMark() image.Image {
+	mark := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(mark, mark.Bounds(), image.NewUniform(color.NRGBA{R: 255, G: 255, B: 255, A: 128}), image.ZP, draw.Src)
+	return mark
+}
+
+func BenchmarkMarkReuse(b *testing.B) {
+	for _, ext := range []string{".jpg", ".png"} {
+		data := testImage(b, ext, 2000, 1500)
+		mimetype := map[string]string{".jpg": "image/jpeg", ".png": "image/png"}[ext]
+
+		for _, reuse := range []bool{false, true} {
+			name := ext[1:] + "/default"
+			if reuse {
+				name = ext[1:] + "/reuse"
+			}
+
+			b.Run(name, func(b *testing.B) {
+				w := NewFromImage(testMark(), &Options{Reuse: reuse})
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := w.MarkMIME(bytes.NewReader(data), io.Discard, mimetype, image.Pt(-100, -100)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestMarkKeepsTranslucentPixels(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	c := color.NRGBA{R: 100, G: 150, B: 200, A: 3}
+	draw.Draw(src, src.Bounds(), image.NewUniform(c), image.ZP, draw.Src)
+
+	path := filepath.Join(t.TempDir(), "src.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = png.Encode(f, src); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// 水印位于图片之外，目标图片的内容应保持不变。
+	w := NewFromImage(image.NewNRGBA(image.Rect(0, 0, 1, 1)), nil)
+	if err := w.MarkFile(path, image.Pt(-10, -10)); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(1, 1)); got != c {
+		t.Errorf("像素为 %v，应为 %v", got, c)
+	}
+}